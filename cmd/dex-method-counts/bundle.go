@@ -17,16 +17,21 @@ limitations under the License.
 
 package main
 
-import "github.com/rsookram/dex-method-counts/internal/dex"
+import (
+	"fmt"
+	"io"
 
-type generator interface {
-	generate(dex.Data, bool, string, uint, filter) countState
-}
+	"github.com/rsookram/dex-method-counts/dexcount"
+)
 
-func newGenerator(countFields bool, outputStyle output) generator {
-	if countFields {
-		return fieldGenerator{outputStyle: outputStyle}
-	} else {
-		return methodGenerator{outputStyle: outputStyle}
+// Prints a section for each module of an app bundle. The combined counts are
+// printed separately.
+func outputModules(w io.Writer, modules []dexcount.Module, f treeFormat, countName string) {
+	for _, module := range modules {
+		fmt.Fprintln(w, "Module "+module.Name+":")
+		outputNode(w, module.Tree, f)
+		fmt.Fprintf(w, "Module %s %s count: %d\n", module.Name, countName, module.Count)
 	}
+
+	fmt.Fprintln(w, "All modules:")
 }
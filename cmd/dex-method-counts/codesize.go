@@ -0,0 +1,81 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+	"github.com/rsookram/dex-method-counts/internal/input"
+	"github.com/rsookram/dex-method-counts/internal/mapping"
+)
+
+// Returns every method defined in the dex which has a code_item, with names
+// restored using the mapping.
+func definedMethodsWithCode(d dex.Data, m *mapping.Mapping) []dex.DefinedMethod {
+	methods := make([]dex.DefinedMethod, 0)
+	for _, classDef := range d.GetClassDefs() {
+		for _, method := range classDef.Methods {
+			if method.Code == nil {
+				continue
+			}
+
+			method.MethodRef = m.MethodRef(method.MethodRef)
+			methods = append(methods, method)
+		}
+	}
+	logger.info("Read in " + strconv.Itoa(len(methods)) + " methods with code.")
+	return methods
+}
+
+// Prints the n methods in the input with the most bytecode, largest first.
+func outputTopMethods(w io.Writer, fileName string, n int, opts countOptions) error {
+	methods := make([]dex.DefinedMethod, 0)
+	libOpts := opts.libraryOptions()
+
+	err := forEachDex(fileName, func(f input.DexFile, d dex.Data) error {
+		for _, method := range definedMethodsWithCode(d, opts.mapping) {
+			if !libOpts.Matches(method.DeclClass) {
+				continue
+			}
+			methods = append(methods, method)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.SliceStable(methods, func(i, j int) bool {
+		return methods[i].Code.InsnsSize > methods[j].Code.InsnsSize
+	})
+
+	if len(methods) > n {
+		methods = methods[:n]
+	}
+
+	fmt.Fprintln(w, "Largest methods in "+fileName+":")
+	for _, method := range methods {
+		fmt.Fprintf(w, "%8d %s\n", method.Code.InsnsBytes(), method.JavaSignature())
+	}
+
+	return nil
+}
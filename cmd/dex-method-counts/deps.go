@@ -0,0 +1,267 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+	"github.com/rsookram/dex-method-counts/internal/input"
+)
+
+const (
+	graphDot = iota
+	graphJSON
+)
+
+// Defaults to having val of graphDot
+type graphFormat struct {
+	val int
+}
+
+func (f graphFormat) String() string {
+	switch f.val {
+	case graphDot:
+		return "DOT"
+	case graphJSON:
+		return "JSON"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func (f *graphFormat) Set(s string) error {
+	s = strings.ToLower(s)
+
+	switch s {
+	case "dot":
+		f.val = graphDot
+		return nil
+	case "json":
+		f.val = graphJSON
+		return nil
+	default:
+		return errors.New("invalid value " + s)
+	}
+}
+
+// Runs the deps command, which prints the graph of references from the code in
+// each package to the members of other packages.
+//
+// Usage: dex-method-counts deps [flags] <file>...
+func runDeps(args []string) {
+	fs := flag.NewFlagSet("deps", flag.ExitOnError)
+	opts := &countOptions{}
+	fs.StringVar(&opts.packageFilter, "package-filter", "", "")
+	depth := fs.Uint("depth", math.MaxUint32, "")
+	fs.StringVar(&opts.mappingPath, "mapping", "", "")
+	var format graphFormat
+	fs.Var(&format, "format", "")
+	quiet := fs.Bool("quiet", false, "")
+	verbose := fs.Bool("verbose", false, "")
+	outPath := fs.String("out", "", "")
+
+	fs.Parse(args)
+
+	setLogLevel(*quiet, *verbose)
+	opts.loadMapping()
+
+	if fs.NArg() == 0 {
+		logger.error("No files given")
+		os.Exit(1)
+	}
+
+	if *depth == 0 {
+		logger.error("-depth must be at least 1")
+		os.Exit(1)
+	}
+
+	out, closeOut := openOutput(*outPath)
+	defer closeOut()
+
+	graph := newPackageGraph(*depth)
+	for _, fileName := range collectFileNames(fs.Args()) {
+		logger.info("Processing " + fileName)
+
+		err := forEachDex(fileName, func(f input.DexFile, d dex.Data) error {
+			codeRefs, err := d.GetCodeRefs()
+			if err != nil {
+				return fmt.Errorf("Failed to decode %s. %v", f.Name, err)
+			}
+
+			graph.add(codeRefs, *opts)
+			return nil
+		})
+		if err != nil {
+			logger.error(err.Error())
+			os.Exit(2)
+		}
+	}
+
+	if format.val == graphJSON {
+		err := graph.writeJSON(out)
+		if err != nil {
+			logger.error("Failed to write graph. " + err.Error())
+			os.Exit(2)
+		}
+		return
+	}
+
+	graph.writeDot(out)
+}
+
+// A directed graph between packages. The weight of an edge is the number of
+// distinct methods and fields in the target package which are referenced from
+// code in the source package.
+type packageGraph struct {
+	// The number of segments package names are truncated to.
+	depth uint
+	// The referenced members of each edge, keyed by source then target.
+	edges map[string]map[string]map[interface{}]struct{}
+}
+
+type packageEdge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Weight int    `json:"weight"`
+}
+
+func newPackageGraph(depth uint) *packageGraph {
+	return &packageGraph{
+		depth: depth,
+		edges: make(map[string]map[string]map[interface{}]struct{}),
+	}
+}
+
+func (g *packageGraph) add(codeRefs []dex.CodeRefs, opts countOptions) {
+	for _, refs := range codeRefs {
+		caller := opts.mapping.MethodRef(refs.Caller)
+		if opts.packageFilter != "" && !strings.HasPrefix(dex.PackageNameOnly(caller.DeclClass), opts.packageFilter) {
+			continue
+		}
+		from := g.packageAtDepth(caller.DeclClass)
+
+		for _, methodRef := range refs.MethodRefs {
+			methodRef = opts.mapping.MethodRef(methodRef)
+			g.addEdge(from, g.packageAtDepth(methodRef.DeclClass), methodRef.Key())
+		}
+
+		for _, fieldRef := range refs.FieldRefs {
+			fieldRef = opts.mapping.FieldRef(fieldRef)
+			g.addEdge(from, g.packageAtDepth(fieldRef.DeclClass), fieldRef)
+		}
+	}
+}
+
+func (g *packageGraph) addEdge(from, to string, key interface{}) {
+	if from == to {
+		return
+	}
+
+	targets, ok := g.edges[from]
+	if !ok {
+		targets = make(map[string]map[interface{}]struct{})
+		g.edges[from] = targets
+	}
+
+	members, ok := targets[to]
+	if !ok {
+		members = make(map[interface{}]struct{})
+		targets[to] = members
+	}
+
+	members[key] = struct{}{}
+}
+
+// Returns the package of the class, truncated to the graph's depth, e.g.
+// "com.example" for "Lcom/example/app/Foo;" at a depth of 2.
+func (g *packageGraph) packageAtDepth(classDescriptor string) string {
+	packageName := dex.PackageNameOnly(classDescriptor)
+	if packageName == "" {
+		return "<no package>"
+	}
+
+	pieces := strings.Split(packageName, ".")
+	if uint(len(pieces)) > g.depth {
+		pieces = pieces[:g.depth]
+	}
+
+	return strings.Join(pieces, ".")
+}
+
+// Returns the edges sorted by source, then target.
+func (g *packageGraph) sortedEdges() []packageEdge {
+	edges := make([]packageEdge, 0)
+	for from, targets := range g.edges {
+		for to, members := range targets {
+			edges = append(edges, packageEdge{From: from, To: to, Weight: len(members)})
+		}
+	}
+
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].From != edges[j].From {
+			return edges[i].From < edges[j].From
+		}
+		return edges[i].To < edges[j].To
+	})
+
+	return edges
+}
+
+func (g *packageGraph) writeDot(w io.Writer) {
+	fmt.Fprintln(w, "digraph packages {")
+	for _, edge := range g.sortedEdges() {
+		fmt.Fprintf(w, "    %s -> %s [weight=%d, label=%d];\n", strconv.Quote(edge.From), strconv.Quote(edge.To), edge.Weight, edge.Weight)
+	}
+	fmt.Fprintln(w, "}")
+}
+
+// Writes the graph as {"nodes": [string], "edges": [{"from": string, "to":
+// string, "weight": int}]}, with both lists sorted.
+func (g *packageGraph) writeJSON(w io.Writer) error {
+	edges := g.sortedEdges()
+
+	nodeSet := make(map[string]struct{})
+	for _, edge := range edges {
+		nodeSet[edge.From] = struct{}{}
+		nodeSet[edge.To] = struct{}{}
+	}
+
+	nodes := make([]string, 0, len(nodeSet))
+	for name := range nodeSet {
+		nodes = append(nodes, name)
+	}
+	sort.Strings(nodes)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(struct {
+		Nodes []string      `json:"nodes"`
+		Edges []packageEdge `json:"edges"`
+	}{nodes, edges})
+}
@@ -0,0 +1,197 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/rsookram/dex-method-counts/dexcount"
+)
+
+// Runs the diff command, which compares the counts of a baseline input with
+// those of a candidate input.
+//
+// Usage: dex-method-counts diff [flags] <baseline> <candidate>
+func runDiff(args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	opts := addCountFlags(fs)
+	failOnIncrease := fs.Int("fail-on-increase", -1, "")
+	quiet := fs.Bool("quiet", false, "")
+	verbose := fs.Bool("verbose", false, "")
+	outPath := fs.String("out", "", "")
+
+	fs.Parse(args)
+
+	setLogLevel(*quiet, *verbose)
+
+	if fs.NArg() != 2 {
+		logger.error("Expected a baseline and a candidate file")
+		os.Exit(1)
+	}
+
+	if opts.outputStyle.val == outputJSON {
+		logger.error("JSON output isn't supported by diff")
+		os.Exit(1)
+	}
+
+	out, closeOut := openOutput(*outPath)
+	defer closeOut()
+
+	report, err := opts.libraryOptions().Count(context.Background(), fs.Args())
+	if err != nil {
+		logger.error(err.Error())
+		os.Exit(2)
+	}
+	baseline, candidate := report.Inputs[0], report.Inputs[1]
+
+	d := diffNodes(baseline.Tree, candidate.Tree)
+	d.output(out, opts.outputStyle)
+
+	delta := candidate.Count - baseline.Count
+	fmt.Fprintf(out, "Overall %s count: %d -> %d (%+d)\n", opts.countName(), baseline.Count, candidate.Count, delta)
+
+	if *failOnIncrease >= 0 && delta > *failOnIncrease {
+		closeOut()
+		logger.error(fmt.Sprintf("%s count increased by %d, which is more than the allowed %d", opts.countName(), delta, *failOnIncrease))
+		os.Exit(3)
+	}
+}
+
+// The difference between a node in the baseline tree and the node with the
+// same name in the candidate tree. A node missing from one tree has a count of
+// 0 on that side.
+type nodeDiff struct {
+	baseline  int
+	candidate int
+	added     bool
+	removed   bool
+	class     bool
+	names     []string
+	children  map[string]*nodeDiff
+}
+
+func diffNodes(base, cand *dexcount.Node) *nodeDiff {
+	d := &nodeDiff{
+		children: make(map[string]*nodeDiff),
+	}
+
+	if base == nil {
+		base = dexcount.NewNode()
+		d.added = true
+	}
+	if cand == nil {
+		cand = dexcount.NewNode()
+		d.removed = true
+	}
+
+	d.baseline = base.Count
+	d.candidate = cand.Count
+	d.class = base.Class || cand.Class
+	d.names = unionNames(base.Names, cand.Names)
+
+	for _, name := range d.names {
+		d.children[name] = diffNodes(base.Children[name], cand.Children[name])
+	}
+
+	return d
+}
+
+// Returns the names found in either list, sorted.
+func unionNames(n, n2 []string) []string {
+	seen := make(map[string]struct{})
+	names := make([]string, 0, len(n)+len(n2))
+
+	for _, list := range [][]string{n, n2} {
+		for _, name := range list {
+			if _, ok := seen[name]; !ok {
+				seen[name] = struct{}{}
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func (d nodeDiff) delta() int {
+	return d.candidate - d.baseline
+}
+
+func (d nodeDiff) changed() bool {
+	return d.delta() != 0 || d.added || d.removed
+}
+
+func (d nodeDiff) label() string {
+	status := ""
+	if d.added {
+		status = ", added"
+	} else if d.removed {
+		status = ", removed"
+	}
+	return fmt.Sprintf("%d -> %d (%+d%s)", d.baseline, d.candidate, d.delta(), status)
+}
+
+func (d nodeDiff) output(w io.Writer, style output) {
+	if style.val == outputTree {
+		d.outputTree(w, "")
+	} else if style.val == outputFlat {
+		d.outputFlat(w)
+	}
+}
+
+// Prints the tree of changed nodes. Subtrees without changes are omitted.
+func (d nodeDiff) outputTree(w io.Writer, indent string) {
+	if len(indent) == 0 {
+		fmt.Fprintln(w, "<root>:", d.label())
+	}
+	indent += "    "
+
+	for _, name := range d.names {
+		child := d.children[name]
+		if !child.changed() {
+			continue
+		}
+
+		fmt.Fprintln(w, indent+nodeLabel(name, child.class)+":", child.label())
+		child.outputTree(w, indent)
+	}
+}
+
+func (d nodeDiff) outputFlat(w io.Writer) {
+	for _, name := range d.names {
+		child := d.children[name]
+		if !child.changed() {
+			continue
+		}
+
+		suffix := ""
+		if child.added {
+			suffix = " (added)"
+		} else if child.removed {
+			suffix = " (removed)"
+		}
+
+		fmt.Fprintf(w, "%+6d %s%s\n", child.delta(), flatLabel(name, child.class), suffix)
+	}
+}
@@ -20,17 +20,19 @@ package main
 import (
 	"errors"
 	"strings"
+
+	"github.com/rsookram/dex-method-counts/dexcount"
 )
 
 const (
-	filterAll = iota
-	filterDefinedOnly
-	filterReferencedOnly
+	filterAll            = dexcount.FilterAll
+	filterDefinedOnly    = dexcount.FilterDefinedOnly
+	filterReferencedOnly = dexcount.FilterReferencedOnly
 )
 
 // Defaults to having val of filterAll
 type filter struct {
-	val int
+	val dexcount.Filter
 }
 
 func (f filter) String() string {
@@ -0,0 +1,220 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+
+	"github.com/rsookram/dex-method-counts/dexcount"
+)
+
+// The version of the JSON report schema. This is bumped whenever a field is
+// removed or changes meaning; adding fields doesn't change the version.
+//
+// Version 1 has the following shape:
+//
+//	{
+//	  "schemaVersion": 1,
+//	  "countType": "method" | "field" | "bytecode byte",
+//	  "options": {
+//	    "includeClasses": bool,
+//	    "nestClasses": bool,
+//	    "collapseAnonymous": bool,
+//	    "synthetic": bool,
+//	    "kotlin": bool,
+//	    "packageFilter": string,
+//	    "maxDepth": int | null,   // null when unlimited
+//	    "filter": "ALL" | "DEFINED_ONLY" | "REFERENCED_ONLY"
+//	  },
+//	  "inputs": [{
+//	    "path": string,           // as given on the command line
+//	    "count": int,             // sum of the dex files' counts
+//	    "uniqueCount": int,       // excluding references made from several dex files
+//	    "synthetic": {kind: int}, // -synthetic only; kinds which don't occur are omitted
+//	    "kotlin": {               // -kotlin only
+//	      "packages": {package: {feature: int}},
+//	      "overhead": int         // estimated method count added by Kotlin
+//	    },
+//	    "tree": node,             // merged across all of the input's dex files
+//	    "dexFiles": [{
+//	      "name": string,
+//	      "module": string,       // app bundles only
+//	      "count": int,
+//	      "tree": node
+//	    }]
+//	  }],
+//	  "overallCount": int         // sum of every input's count
+//	}
+//
+// where node is {"name": string, "count": int, "synthetic": int, "class":
+// bool, "children": [node]}. The root node is named "<root>", and children are
+// omitted for leaves. "synthetic" is the part of count from synthetic methods,
+// and is only present with -synthetic. "class" is only present, and true, for
+// class nodes counted with -nest-classes.
+const jsonSchemaVersion = 1
+
+type jsonReport struct {
+	SchemaVersion int         `json:"schemaVersion"`
+	CountType     string      `json:"countType"`
+	Options       jsonOptions `json:"options"`
+	Inputs        []jsonInput `json:"inputs"`
+	OverallCount  int         `json:"overallCount"`
+}
+
+type jsonOptions struct {
+	IncludeClasses    bool   `json:"includeClasses"`
+	NestClasses       bool   `json:"nestClasses"`
+	CollapseAnonymous bool   `json:"collapseAnonymous"`
+	Synthetic         bool   `json:"synthetic"`
+	Kotlin            bool   `json:"kotlin"`
+	PackageFilter     string `json:"packageFilter"`
+	MaxDepth          *uint  `json:"maxDepth"`
+	Filter            string `json:"filter"`
+}
+
+type jsonInput struct {
+	Path        string         `json:"path"`
+	Count       int            `json:"count"`
+	UniqueCount int            `json:"uniqueCount"`
+	Synthetic   map[string]int `json:"synthetic,omitempty"`
+	Kotlin      *jsonKotlin    `json:"kotlin,omitempty"`
+	Tree        jsonNode       `json:"tree"`
+	DexFiles    []jsonDexFile  `json:"dexFiles"`
+}
+
+type jsonKotlin struct {
+	Packages map[string]map[string]int `json:"packages"`
+	Overhead int                       `json:"overhead"`
+}
+
+type jsonDexFile struct {
+	Name   string   `json:"name"`
+	Module string   `json:"module,omitempty"`
+	Count  int      `json:"count"`
+	Tree   jsonNode `json:"tree"`
+}
+
+type jsonNode struct {
+	Name      string     `json:"name"`
+	Count     int        `json:"count"`
+	Synthetic *int       `json:"synthetic,omitempty"`
+	Class     bool       `json:"class,omitempty"`
+	Children  []jsonNode `json:"children,omitempty"`
+}
+
+func newJSONReport(opts countOptions, report *dexcount.Report) *jsonReport {
+	var depth *uint
+	if opts.maxDepth != math.MaxUint32 {
+		depth = &opts.maxDepth
+	}
+
+	r := &jsonReport{
+		SchemaVersion: jsonSchemaVersion,
+		CountType:     opts.countName(),
+		Options: jsonOptions{
+			IncludeClasses:    opts.includeClasses,
+			NestClasses:       opts.nestClasses,
+			CollapseAnonymous: opts.collapseAnon,
+			Synthetic:         opts.synthetic,
+			Kotlin:            opts.kotlin,
+			PackageFilter:     opts.packageFilter,
+			MaxDepth:          depth,
+			Filter:            opts.filter.String(),
+		},
+		Inputs:       make([]jsonInput, 0, len(report.Inputs)),
+		OverallCount: report.Count,
+	}
+
+	for _, in := range report.Inputs {
+		input := newJSONInput(in, opts.synthetic)
+		if opts.kotlin {
+			input.Kotlin = newJSONKotlin(in.Kotlin)
+		}
+		r.Inputs = append(r.Inputs, input)
+	}
+
+	return r
+}
+
+func newJSONInput(in dexcount.Input, synthetic bool) jsonInput {
+	input := jsonInput{
+		Path:        in.Path,
+		Count:       in.Count,
+		UniqueCount: in.UniqueCount,
+		Tree:        toJSON(in.Tree, "<root>", synthetic),
+		DexFiles:    make([]jsonDexFile, 0, len(in.DexFiles)),
+	}
+
+	for kind, count := range in.Synthetic {
+		if input.Synthetic == nil {
+			input.Synthetic = make(map[string]int)
+		}
+		input.Synthetic[kind.String()] = count
+	}
+
+	for _, f := range in.DexFiles {
+		input.DexFiles = append(input.DexFiles, jsonDexFile{
+			Name:   f.Name,
+			Module: f.Module,
+			Count:  f.Count,
+			Tree:   toJSON(f.Tree, "<root>", synthetic),
+		})
+	}
+
+	return input
+}
+
+func newJSONKotlin(k dexcount.KotlinCounts) *jsonKotlin {
+	j := &jsonKotlin{
+		Packages: make(map[string]map[string]int, len(k.Packages)),
+		Overhead: k.Overhead(),
+	}
+
+	for packageName, features := range k.Packages {
+		counts := make(map[string]int, len(features))
+		for feature, count := range features {
+			counts[feature.String()] = count
+		}
+		j.Packages[packageName] = counts
+	}
+
+	return j
+}
+
+func (r *jsonReport) write(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.SetEscapeHTML(false)
+	return enc.Encode(r)
+}
+
+func toJSON(n *dexcount.Node, name string, synthetic bool) jsonNode {
+	j := jsonNode{Name: name, Count: n.Count, Class: n.Class}
+	if synthetic {
+		count := n.Synthetic
+		j.Synthetic = &count
+	}
+
+	for _, childName := range n.Names {
+		j.Children = append(j.Children, toJSON(n.Children[childName], childName, synthetic))
+	}
+
+	return j
+}
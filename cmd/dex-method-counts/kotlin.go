@@ -0,0 +1,77 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/rsookram/dex-method-counts/dexcount"
+)
+
+// Prints a table of the method references from each Kotlin feature, with a
+// row for each package that has any, followed by the references into the
+// standard library and the estimated overhead of Kotlin.
+func outputKotlin(w io.Writer, in dexcount.Input) {
+	packages := make([]string, 0, len(in.Kotlin.Packages))
+	for packageName := range in.Kotlin.Packages {
+		packages = append(packages, packageName)
+	}
+	sort.Strings(packages)
+
+	labelWidth := len("<no package>")
+	for _, packageName := range packages {
+		if len(packageName) > labelWidth {
+			labelWidth = len(packageName)
+		}
+	}
+
+	fmt.Fprintln(w, "Kotlin method count by package:")
+	fmt.Fprintf(w, "%-*s", labelWidth, "")
+	for _, feature := range dexcount.KotlinFeatures {
+		fmt.Fprintf(w, "  %*s", columnWidth(feature), feature)
+	}
+	fmt.Fprintln(w)
+
+	for _, packageName := range packages {
+		fmt.Fprintf(w, "%-*s", labelWidth, flatLabel(packageName, false))
+		for _, feature := range dexcount.KotlinFeatures {
+			fmt.Fprintf(w, "  %*d", columnWidth(feature), in.Kotlin.Packages[packageName][feature])
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "%-*s", labelWidth, "Total")
+	for _, feature := range dexcount.KotlinFeatures {
+		fmt.Fprintf(w, "  %*d", columnWidth(feature), in.Kotlin.Total(feature))
+	}
+	fmt.Fprintln(w)
+
+	fmt.Fprintf(w, "Kotlin stdlib method count: %d\n", in.Kotlin.Stdlib())
+
+	overhead := in.Kotlin.Overhead()
+	fmt.Fprintf(w, "Estimated Kotlin overhead: %d methods (%.1f%% of %d)\n", overhead, percentOf(overhead, in.Count), in.Count)
+}
+
+func columnWidth(feature dexcount.KotlinFeature) int {
+	if width := len(feature.String()); width > 6 {
+		return width
+	}
+	return 6
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+)
+
+// The number of entries an ID section can hold before a 16-bit index into it
+// overflows.
+const idLimit = 65536
+
+type idUsage struct {
+	name  string
+	count int
+	// Set for strings, which are only limited when jumbo mode is off, since
+	// const-string/jumbo can reference any string.
+	jumbo bool
+}
+
+func (u idUsage) percent() float64 {
+	return float64(u.count) * 100 / idLimit
+}
+
+func idUsages(counts dex.IdCounts) []idUsage {
+	usages := []idUsage{
+		{name: "methods", count: counts.Methods},
+		{name: "fields", count: counts.Fields},
+		{name: "types", count: counts.Types},
+		{name: "protos", count: counts.Protos},
+		{name: "strings", count: counts.Strings, jumbo: true},
+	}
+
+	// These sections only exist from version 038, so they're left out of
+	// older files' reports rather than always showing zero.
+	if counts.CallSites > 0 {
+		usages = append(usages, idUsage{name: "call sites", count: counts.CallSites})
+	}
+	if counts.MethodHandles > 0 {
+		usages = append(usages, idUsage{name: "method handles", count: counts.MethodHandles})
+	}
+
+	return usages
+}
+
+// Returns the usage which is closest to its limit. Strings are left out, since
+// they almost always outnumber the rest, but jumbo mode lifts their limit.
+func closestLimit(usages []idUsage) idUsage {
+	var closest idUsage
+	for _, u := range usages {
+		if !u.jumbo && (closest.name == "" || u.count > closest.count) {
+			closest = u
+		}
+	}
+	return closest
+}
+
+// Prints how much of each 64K index limit the given dex file uses, followed by
+// the limit which is closest to being reached.
+func outputLimits(w io.Writer, name string, d dex.Data) {
+	usages := idUsages(d.IdCounts())
+
+	fmt.Fprintln(w, name+":")
+
+	for _, u := range usages {
+		fmt.Fprintf(w, "    %-15s %6d / %d (%5.1f%%)", u.name+":", u.count, idLimit, u.percent())
+		if u.jumbo {
+			fmt.Fprint(w, "  (not a limit in jumbo mode)")
+		}
+		fmt.Fprintln(w)
+	}
+
+	closest := closestLimit(usages)
+	fmt.Fprintf(w, "    closest limit: %s (%.1f%%)\n", closest.name, closest.percent())
+}
@@ -0,0 +1,62 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+)
+
+func TestClosestLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts dex.IdCounts
+		want   string
+	}{
+		// Strings outnumber methods, as they do in most apps, but aren't
+		// picked.
+		{
+			name:   "method-heavy",
+			counts: dex.IdCounts{Methods: 60000, Fields: 30000, Types: 8000, Protos: 9000, Strings: 64000},
+			want:   "methods",
+		},
+		{
+			name:   "field-heavy",
+			counts: dex.IdCounts{Methods: 40000, Fields: 50000, Types: 8000, Protos: 9000, Strings: 64000},
+			want:   "fields",
+		},
+		{
+			name:   "call sites",
+			counts: dex.IdCounts{Methods: 100, Strings: 64000, CallSites: 200},
+			want:   "call sites",
+		},
+		{
+			name: "empty",
+			want: "methods",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := closestLimit(idUsages(tt.counts)); got.name != tt.want {
+				t.Errorf("closestLimit() = %s, want %s", got.name, tt.want)
+			}
+		})
+	}
+}
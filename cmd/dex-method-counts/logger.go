@@ -0,0 +1,70 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+const (
+	logQuiet = iota
+	logNormal
+	logVerbose
+)
+
+// Writes progress and diagnostic messages, keeping them out of the stream
+// that results are written to.
+type leveledLogger struct {
+	w     io.Writer
+	level int
+}
+
+// The logger used for all diagnostics. Results never go through it.
+var logger = leveledLogger{w: os.Stderr, level: logNormal}
+
+// Logs an error. Errors are logged even when quiet.
+func (l leveledLogger) error(a ...interface{}) {
+	fmt.Fprintln(l.w, a...)
+}
+
+// Logs a progress message, unless quiet.
+func (l leveledLogger) info(a ...interface{}) {
+	if l.level >= logNormal {
+		fmt.Fprintln(l.w, a...)
+	}
+}
+
+// Logs a detailed message, only when verbose.
+func (l leveledLogger) debug(a ...interface{}) {
+	if l.level >= logVerbose {
+		fmt.Fprintln(l.w, a...)
+	}
+}
+
+// Implements dexcount.Logger, so that progress messages from counting go
+// through the same log levels.
+func (l leveledLogger) Info(msg string) {
+	l.info(msg)
+}
+
+// Implements dexcount.Logger.
+func (l leveledLogger) Debug(msg string) {
+	l.debug(msg)
+}
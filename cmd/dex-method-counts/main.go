@@ -18,7 +18,8 @@ limitations under the License.
 package main
 
 import (
-	"archive/zip"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -26,135 +27,293 @@ import (
 	"math"
 	"os"
 	"path/filepath"
-	"strings"
 
+	"github.com/rsookram/dex-method-counts/dexcount"
 	"github.com/rsookram/dex-method-counts/internal/dex"
+	"github.com/rsookram/dex-method-counts/internal/input"
+	"github.com/rsookram/dex-method-counts/internal/mapping"
 )
 
 func main() {
-	countFields := flag.Bool("count-fields", false, "")
-	includeClasses := flag.Bool("include-classes", false, "")
-	packageFilter := flag.String("package-filter", "", "")
-	maxDepth := flag.Uint("max-depth", math.MaxUint32, "")
-
-	var filter filter
-	flag.Var(&filter, "filter", "")
+	if len(os.Args) > 1 && os.Args[1] == "diff" {
+		runDiff(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "why" {
+		runWhy(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "deps" {
+		runDeps(os.Args[2:])
+		return
+	}
 
-	var output output
-	flag.Var(&output, "output-style", "")
+	fs := flag.CommandLine
+	opts := addCountFlags(fs)
+	fs.BoolVar(&opts.synthetic, "synthetic", false, "")
+	fs.BoolVar(&opts.kotlin, "kotlin", false, "")
+	countLimits := fs.Bool("limits", false, "")
+	showSections := fs.Bool("sections", false, "")
+	countUnique := fs.Bool("unique", false, "")
+	mergeInputs := fs.Bool("merge", false, "")
+	tableInputs := fs.Bool("table", false, "")
+	topMethods := fs.Int("top", 0, "")
+	verify := fs.Bool("verify", false, "")
+	quiet := fs.Bool("quiet", false, "")
+	verbose := fs.Bool("verbose", false, "")
+	outPath := fs.String("out", "", "")
 
 	flag.Parse()
 
+	setLogLevel(*quiet, *verbose)
+	if *topMethods > 0 {
+		opts.loadMapping()
+	}
+
 	fileNames := flag.Args()
 	if len(fileNames) == 0 {
-		fmt.Fprintln(os.Stderr, "No files given")
+		logger.error("No files given")
 		os.Exit(1)
 	}
 
-	var overallCount int
-	for _, fileName := range collectFileNames(fileNames) {
-		fmt.Println("Processing " + fileName)
+	if opts.synthetic && opts.countFields {
+		logger.error("-synthetic can't be combined with -count-fields")
+		os.Exit(1)
+	}
 
-		counter := newDexCounter(*countFields, output)
+	if *countUnique && opts.countCode {
+		logger.error("-unique can't be combined with -code-size")
+		os.Exit(1)
+	}
 
-		dexFiles, err := openInputFiles(fileName)
-		if err != nil {
-			fmt.Fprintln(os.Stderr, "Failed to open dex files. "+err.Error())
-			os.Exit(2)
-			return
-		}
+	if opts.kotlin && (opts.countFields || opts.countCode) {
+		logger.error("-kotlin only applies to method counts")
+		os.Exit(1)
+	}
 
-		for _, f := range dexFiles {
-			defer f.Close()
-		}
+	if *tableInputs && opts.outputStyle.val == outputJSON {
+		logger.error("-table can't be combined with JSON output")
+		os.Exit(1)
+	}
+
+	out, closeOut := openOutput(*outPath)
+	defer closeOut()
+
+	inputFileNames := collectFileNames(fileNames)
+
+	if *verify && !verifyInputs(inputFileNames) {
+		closeOut()
+		os.Exit(4)
+	}
+
+	if *countLimits || *showSections || *topMethods > 0 {
+		for _, fileName := range inputFileNames {
+			logger.info("Processing " + fileName)
+
+			var err error
+			if *countLimits {
+				err = forEachDex(fileName, func(f input.DexFile, d dex.Data) error {
+					outputLimits(out, f.Name, d)
+					return nil
+				})
+			} else if *showSections {
+				err = forEachDex(fileName, func(f input.DexFile, d dex.Data) error {
+					outputSections(out, f.Name, d)
+					return nil
+				})
+			} else {
+				err = outputTopMethods(out, fileName, *topMethods, *opts)
+			}
 
-		for _, dexFile := range dexFiles {
-			data, err := dex.New(dexFile)
 			if err != nil {
-				fmt.Fprintln(os.Stderr, "Failed to load dex file "+err.Error())
+				logger.error(err.Error())
 				os.Exit(2)
 			}
-
-			counter.generate(*data, *includeClasses, *packageFilter, *maxDepth, filter)
 		}
-		counter.output()
-		overallCount = counter.overallCount
+		return
 	}
 
-	fmt.Printf("Overall %s count: %d\n", countFieldsString(*countFields), overallCount)
-}
-
-// Opens an input file, which could be a .dex or a .jar/.apk with a classes.dex
-// inside. If the latter, we extract the contents to a temporary file.
-func openInputFiles(fileName string) ([]os.File, error) {
-	dexFiles, err := openInputFileAsZip(fileName)
+	report, err := opts.libraryOptions().Count(context.Background(), inputFileNames)
 	if err != nil {
-		return []os.File{}, err
+		logger.error(err.Error())
+		os.Exit(2)
 	}
 
-	if len(dexFiles) == 0 {
-		file, err := os.Open(fileName)
-		if err != nil {
-			return []os.File{}, err
+	if opts.outputStyle.val == outputJSON {
+		if err := newJSONReport(*opts, report).write(out); err != nil {
+			logger.error("Failed to write report. " + err.Error())
+			os.Exit(2)
 		}
-
-		return []os.File{*file}, nil
+		return
 	}
 
-	return dexFiles, err
-}
+	if *tableInputs {
+		outputTable(out, report.Inputs, opts.outputStyle)
+	} else {
+		for _, in := range report.Inputs {
+			if len(report.Inputs) > 1 {
+				fmt.Fprintln(out, in.Path+":")
+			}
 
-// Tries to open an input file as a Zip archive (jar/apk) with a "classes.dex"
-// inside.
-func openInputFileAsZip(fileName string) ([]os.File, error) {
-	reader, err := zip.OpenReader(fileName)
-	if err != nil {
-		// Probably not a zip
-		return []os.File{}, nil
-	}
-	defer reader.Close()
+			if modules := in.Modules(); modules != nil {
+				outputModules(out, modules, opts.treeFormat(), opts.countName())
+			}
 
-	dexFiles := make([]os.File, 0)
-	for _, file := range reader.File {
-		name := file.Name
-		if strings.HasPrefix(name, "classes") && strings.HasSuffix(name, ".dex") {
-			dexFile, err := openDexFile(*file)
-			if err != nil {
-				return []os.File{}, err
+			outputNode(out, in.Tree, opts.treeFormat())
+			if opts.synthetic {
+				outputSynthetic(out, in, opts.countName())
+			}
+			if opts.kotlin {
+				outputKotlin(out, in)
+			}
+			if *countUnique {
+				outputUnique(out, in, opts.countName())
 			}
+			if len(report.Inputs) > 1 {
+				fmt.Fprintf(out, "%s %s count: %d\n", in.Path, opts.countName(), in.Count)
+			}
+		}
 
-			dexFiles = append(dexFiles, *dexFile)
+		if *mergeInputs && len(report.Inputs) > 1 {
+			outputMerged(out, report.Inputs, opts.treeFormat())
 		}
 	}
 
-	return dexFiles, nil
+	fmt.Fprintf(out, "Overall %s count: %d\n", opts.countName(), report.Count)
+}
+
+// Options which control how each input is counted and how the counts are
+// displayed.
+type countOptions struct {
+	countFields    bool
+	countCode      bool
+	includeClasses bool
+	nestClasses    bool
+	collapseAnon   bool
+	synthetic      bool
+	kotlin         bool
+	packageFilter  string
+	maxDepth       uint
+	filter         filter
+	outputStyle    output
+
+	mappingPath string
+	// Loaded from mappingPath by loadMapping. nil when no mapping was given,
+	// and when counting, since dexcount loads the mapping itself.
+	mapping *mapping.Mapping
 }
 
-func openDexFile(zf zip.File) (*os.File, error) {
-	fileReader, err := zf.Open()
+// Registers the flags which populate countOptions on the given flag set.
+func addCountFlags(fs *flag.FlagSet) *countOptions {
+	opts := &countOptions{}
+
+	fs.BoolVar(&opts.countFields, "count-fields", false, "")
+	fs.BoolVar(&opts.countCode, "code-size", false, "")
+	fs.BoolVar(&opts.includeClasses, "include-classes", false, "")
+	fs.BoolVar(&opts.nestClasses, "nest-classes", false, "")
+	fs.BoolVar(&opts.collapseAnon, "collapse-anonymous", false, "")
+	fs.StringVar(&opts.packageFilter, "package-filter", "", "")
+	fs.UintVar(&opts.maxDepth, "max-depth", math.MaxUint32, "")
+	fs.Var(&opts.filter, "filter", "")
+	fs.Var(&opts.outputStyle, "output-style", "")
+	fs.StringVar(&opts.mappingPath, "mapping", "", "")
+
+	return opts
+}
+
+// Loads the mapping file given with -mapping, if any. Exits if it can't be
+// read.
+func (o *countOptions) loadMapping() {
+	if o.mappingPath == "" {
+		return
+	}
+
+	m, err := mapping.Open(o.mappingPath)
 	if err != nil {
-		return nil, err
+		logger.error("Failed to load mapping file. " + err.Error())
+		os.Exit(1)
 	}
-	defer fileReader.Close()
+	logger.debug("Loaded mapping from " + o.mappingPath)
+
+	o.mapping = m
+}
 
-	// Create a temp file to hold the DEX data, open it, and delete it to ensure
-	// it doesn't hang around if we fail.
-	tmpFile, err := ioutil.TempFile("", "dex")
+func setLogLevel(quiet, verbose bool) {
+	if quiet {
+		logger.level = logQuiet
+	} else if verbose {
+		logger.level = logVerbose
+	}
+}
+
+// Returns the writer that results should go to, along with a function to call
+// once writing is done. Exits if the file can't be created.
+func openOutput(path string) (io.Writer, func()) {
+	if path == "" {
+		return os.Stdout, func() {}
+	}
+
+	f, err := os.Create(path)
 	if err != nil {
-		return nil, err
+		logger.error("Failed to create output file. " + err.Error())
+		os.Exit(1)
+	}
+
+	return f, func() { f.Close() }
+}
+
+// Loads each dex file in the given input and passes it to fn, in the order
+// they appear in the input. Stops at the first error fn returns. Jars and aars
+// of class files are rejected, since only counting supports them.
+func forEachDex(fileName string, fn func(f input.DexFile, d dex.Data) error) error {
+	err := input.ForEachDex(fileName, func(f input.DexFile, d *dex.Data) error {
+		logger.debug(fmt.Sprintf("Loaded %s (dex version %03d)", f.Name, d.Version()))
+		return fn(f, *d)
+	})
+	if errors.Is(err, input.ErrClassFiles) {
+		return fmt.Errorf("%w. Jars and aars can only be counted.", err)
+	}
+	return err
+}
+
+// Converts the flags into the options used by the dexcount package.
+func (o countOptions) libraryOptions() dexcount.Options {
+	opts := dexcount.Options{
+		Filter:            o.filter.val,
+		IncludeClasses:    o.includeClasses,
+		NestInnerClasses:  o.nestClasses,
+		CollapseAnonymous: o.collapseAnon,
+		ClassifySynthetic: o.synthetic,
+		Kotlin:            o.kotlin,
+		PackageFilter:     o.packageFilter,
+		Flat:              o.outputStyle.val == outputFlat,
+		MappingFile:       o.mappingPath,
+		Logger:            logger,
 	}
-	defer os.Remove(tmpFile.Name())
 
-	// Copy all data from reader to output file.
-	if _, err := io.Copy(tmpFile, fileReader); err != nil {
-		return nil, err
+	if o.maxDepth != math.MaxUint32 {
+		depth := o.maxDepth
+		opts.MaxDepth = &depth
 	}
 
-	return tmpFile, nil
+	if o.countCode {
+		opts.Unit = dexcount.CodeBytes
+	} else if o.countFields {
+		opts.Unit = dexcount.Fields
+	}
+
+	return opts
+}
+
+func (o countOptions) treeFormat() treeFormat {
+	return treeFormat{style: o.outputStyle, synthetic: o.synthetic}
 }
 
-func countFieldsString(countFields bool) string {
-	if countFields {
+// Returns the name of what's being counted, for labelling counts.
+func (o countOptions) countName() string {
+	if o.countCode {
+		return "bytecode byte"
+	} else if o.countFields {
 		return "field"
 	}
 	return "method"
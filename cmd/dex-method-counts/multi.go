@@ -0,0 +1,111 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/rsookram/dex-method-counts/dexcount"
+)
+
+// Returns a tree combining the package trees of all the inputs.
+func mergeInputTrees(inputs []dexcount.Input) *dexcount.Node {
+	trees := make([]*dexcount.Node, len(inputs))
+	for i, input := range inputs {
+		trees[i] = input.Tree
+	}
+	return dexcount.Merge(trees...)
+}
+
+// Prints a single tree with the combined counts of all the inputs.
+func outputMerged(w io.Writer, inputs []dexcount.Input, f treeFormat) {
+	fmt.Fprintln(w, "All inputs:")
+
+	outputNode(w, mergeInputTrees(inputs), f)
+}
+
+// Prints the package counts of each input side by side, with a column per
+// input. Every package which appears in any input gets a row.
+func outputTable(w io.Writer, inputs []dexcount.Input, style output) {
+	rows := make([]tableRow, 0)
+	merged := mergeInputTrees(inputs)
+	if style.val == outputFlat {
+		for _, name := range merged.Names {
+			label := flatLabel(name, merged.Children[name].Class)
+			rows = append(rows, tableRow{label: label, path: []string{name}})
+		}
+	} else {
+		rows = append(rows, tableRow{label: "<root>"})
+		rows = appendTreeRows(rows, merged, nil, "    ")
+	}
+
+	labelWidth := 0
+	for _, row := range rows {
+		if len(row.label) > labelWidth {
+			labelWidth = len(row.label)
+		}
+	}
+
+	headers := make([]string, len(inputs))
+	widths := make([]int, len(inputs))
+	for i, input := range inputs {
+		headers[i] = filepath.Base(input.Path)
+		widths[i] = len(headers[i])
+		if widths[i] < 6 {
+			widths[i] = 6
+		}
+	}
+
+	fmt.Fprintf(w, "%-*s", labelWidth, "")
+	for i, header := range headers {
+		fmt.Fprintf(w, "  %*s", widths[i], header)
+	}
+	fmt.Fprintln(w)
+
+	for _, row := range rows {
+		fmt.Fprintf(w, "%-*s", labelWidth, row.label)
+		for i, input := range inputs {
+			fmt.Fprintf(w, "  %*d", widths[i], input.Tree.CountAt(row.path...))
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "%-*s", labelWidth, "Total")
+	for i, input := range inputs {
+		fmt.Fprintf(w, "  %*d", widths[i], input.Count)
+	}
+	fmt.Fprintln(w)
+}
+
+type tableRow struct {
+	label string
+	// The names of the nodes leading from the root to this row's node.
+	path []string
+}
+
+func appendTreeRows(rows []tableRow, n *dexcount.Node, path []string, indent string) []tableRow {
+	for _, name := range n.Names {
+		childPath := append(append([]string{}, path...), name)
+		child := n.Children[name]
+		rows = append(rows, tableRow{label: indent + nodeLabel(name, child.Class), path: childPath})
+		rows = appendTreeRows(rows, child, childPath, indent+"    ")
+	}
+	return rows
+}
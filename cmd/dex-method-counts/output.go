@@ -25,6 +25,7 @@ import (
 const (
 	outputTree = iota
 	outputFlat
+	outputJSON
 )
 
 // Defaults to having val of outputTree
@@ -38,6 +39,8 @@ func (o output) String() string {
 		return "TREE"
 	case outputFlat:
 		return "FLAT"
+	case outputJSON:
+		return "JSON"
 	default:
 		return "UNKNOWN"
 	}
@@ -53,6 +56,9 @@ func (o *output) Set(s string) error {
 	case "flat":
 		o.val = outputFlat
 		return nil
+	case "json":
+		o.val = outputJSON
+		return nil
 	default:
 		return errors.New("invalid value " + s)
 	}
@@ -0,0 +1,50 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+)
+
+// Prints how the bytes of the given dex file are split across the sections in
+// its map_list, largest first.
+func outputSections(w io.Writer, name string, d dex.Data) {
+	sections := d.Sections()
+	sort.SliceStable(sections, func(i, j int) bool {
+		return sections[i].Size > sections[j].Size
+	})
+
+	total := 0
+	for _, s := range sections {
+		total += s.Size
+	}
+
+	fmt.Fprintln(w, name+":")
+	for _, s := range sections {
+		percent := 0.0
+		if total > 0 {
+			percent = float64(s.Size) * 100 / float64(total)
+		}
+		fmt.Fprintf(w, "    %-27s %9d bytes (%5.1f%%) %7d items\n", s.Name+":", s.Size, percent, s.Count)
+	}
+	fmt.Fprintf(w, "    %-27s %9d bytes\n", "total:", total)
+}
@@ -0,0 +1,41 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/rsookram/dex-method-counts/dexcount"
+)
+
+// Prints how much of the input's count is from synthetic methods, broken down
+// by the kind of synthetic method. Kinds which don't occur are left out.
+func outputSynthetic(w io.Writer, in dexcount.Input, countName string) {
+	total := 0
+	for _, count := range in.Synthetic {
+		total += count
+	}
+
+	fmt.Fprintf(w, "Synthetic %s count: %d (%.1f%% of %d)\n", countName, total, percentOf(total, in.Count), in.Count)
+	for _, kind := range dexcount.SyntheticKinds {
+		if count := in.Synthetic[kind]; count > 0 {
+			fmt.Fprintf(w, "    %s: %d\n", kind, count)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/rsookram/dex-method-counts/dexcount"
+)
+
+// How package trees are printed.
+type treeFormat struct {
+	style output
+	// Shows how much of each count is from synthetic methods.
+	synthetic bool
+}
+
+func outputNode(w io.Writer, n *dexcount.Node, f treeFormat) {
+	if f.style.val == outputTree {
+		outputNodeTree(w, n, f, "")
+	} else if f.style.val == outputFlat {
+		outputNodeFlat(w, n, f)
+	}
+}
+
+func outputNodeTree(w io.Writer, n *dexcount.Node, f treeFormat, indent string) {
+	if len(indent) == 0 {
+		fmt.Fprintln(w, "<root>:", f.count(n))
+	}
+	indent += "    "
+
+	for _, name := range n.Names {
+		child := n.Children[name]
+		fmt.Fprintln(w, indent+nodeLabel(name, child.Class)+":", f.count(child))
+		outputNodeTree(w, child, f, indent)
+	}
+}
+
+func outputNodeFlat(w io.Writer, n *dexcount.Node, f treeFormat) {
+	for _, name := range n.Names {
+		child := n.Children[name]
+		fmt.Fprintf(w, "%6d %s%s\n", child.Count, flatLabel(name, child.Class), f.syntheticSuffix(child))
+	}
+}
+
+// Formats a node's count, e.g. "120" or "120 (30 synthetic, 25.0%)".
+func (f treeFormat) count(n *dexcount.Node) string {
+	return fmt.Sprint(n.Count) + f.syntheticSuffix(n)
+}
+
+func (f treeFormat) syntheticSuffix(n *dexcount.Node) string {
+	if !f.synthetic {
+		return ""
+	}
+	return fmt.Sprintf(" (%d synthetic, %.1f%%)", n.Synthetic, percentOf(n.Synthetic, n.Count))
+}
+
+func percentOf(part, whole int) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(whole)
+}
+
+// Returns the label to show for a node in a tree. Classes are marked so that
+// they can be told apart from packages when inner classes are nested.
+func nodeLabel(name string, class bool) string {
+	if class {
+		return "class " + name
+	}
+	return name
+}
+
+// Returns the label to show for a node in a flat list, which is named by the
+// full package or class name.
+func flatLabel(name string, class bool) string {
+	if name == "" {
+		return "<no package>"
+	}
+	return nodeLabel(name, class)
+}
@@ -0,0 +1,46 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/rsookram/dex-method-counts/dexcount"
+)
+
+// Prints the number of distinct references across all of the input's dex
+// files, alongside each dex file's own count. The difference between the sum
+// of the dex files and the unique count is the cost of references which are
+// repeated in several dex files.
+func outputUnique(w io.Writer, in dexcount.Input, countName string) {
+	unique := in.UniqueCount
+
+	fmt.Fprintf(w, "Unique %s count: %d\n", countName, unique)
+	for _, f := range in.DexFiles {
+		fmt.Fprintf(w, "    %s: %d\n", f.Name, f.Count)
+	}
+	fmt.Fprintf(w, "    sum of dex files: %d\n", in.Count)
+
+	duplicated := in.Count - unique
+	percent := 0.0
+	if unique > 0 {
+		percent = float64(duplicated) * 100 / float64(unique)
+	}
+	fmt.Fprintf(w, "    duplicated across dex files: %d (%.1f%% of unique)\n", duplicated, percent)
+}
@@ -0,0 +1,60 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"path/filepath"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+	"github.com/rsookram/dex-method-counts/internal/input"
+)
+
+// Checks the checksum and signature of every dex file in the given inputs,
+// logging each one which doesn't match. Class files carry neither, so jars and
+// aars are skipped. Returns whether every dex file passed.
+func verifyInputs(fileNames []string) bool {
+	ok := true
+
+	for _, fileName := range fileNames {
+		err := forEachDex(fileName, func(f input.DexFile, d dex.Data) error {
+			name := fileName
+			if f.Name != filepath.Base(fileName) {
+				name = f.Name + " in " + fileName
+			}
+
+			if err := d.Verify().Err(); err != nil {
+				logger.error("Verification of " + name + " failed. " + err.Error())
+				ok = false
+				return nil
+			}
+			logger.debug("Verified " + name)
+			return nil
+		})
+		if errors.Is(err, input.ErrClassFiles) {
+			logger.debug("Skipping verification of " + fileName + ", which holds class files")
+			continue
+		}
+		if err != nil {
+			logger.error(err.Error())
+			ok = false
+		}
+	}
+
+	return ok
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+	"github.com/rsookram/dex-method-counts/internal/input"
+)
+
+// Runs the why command, which lists the methods whose code references a given
+// method or field.
+//
+// Usage: dex-method-counts why [flags] <class>#<member> <file>...
+func runWhy(args []string) {
+	fs := flag.NewFlagSet("why", flag.ExitOnError)
+	opts := &countOptions{}
+	fs.StringVar(&opts.mappingPath, "mapping", "", "")
+	quiet := fs.Bool("quiet", false, "")
+	verbose := fs.Bool("verbose", false, "")
+	outPath := fs.String("out", "", "")
+
+	fs.Parse(args)
+
+	setLogLevel(*quiet, *verbose)
+	opts.loadMapping()
+
+	if fs.NArg() < 2 {
+		logger.error("Expected a member, e.g. com.example.Foo#bar, and at least one file")
+		os.Exit(1)
+	}
+
+	target, err := parseMemberTarget(fs.Arg(0))
+	if err != nil {
+		logger.error(err.Error())
+		os.Exit(1)
+	}
+
+	out, closeOut := openOutput(*outPath)
+	defer closeOut()
+
+	callers := newCallerIndex()
+	for _, fileName := range collectFileNames(fs.Args()[1:]) {
+		logger.info("Processing " + fileName)
+
+		err := forEachDex(fileName, func(f input.DexFile, d dex.Data) error {
+			codeRefs, err := d.GetCodeRefs()
+			if err != nil {
+				return fmt.Errorf("Failed to decode %s. %v", f.Name, err)
+			}
+			logger.info("Decoded " + strconv.Itoa(len(codeRefs)) + " methods in " + f.Name + ".")
+
+			callers.add(codeRefs, *opts, target)
+			return nil
+		})
+		if err != nil {
+			logger.error(err.Error())
+			os.Exit(2)
+		}
+	}
+
+	callers.output(out, target)
+}
+
+// A method or field given on the command line, e.g. "com.example.Foo#bar".
+type memberTarget struct {
+	// The type descriptor of the declaring class.
+	class string
+	name  string
+}
+
+func parseMemberTarget(s string) (memberTarget, error) {
+	hash := strings.LastIndexByte(s, '#')
+	if hash <= 0 || hash == len(s)-1 {
+		return memberTarget{}, errors.New("invalid member " + s + ", expected e.g. com.example.Foo#bar")
+	}
+
+	return memberTarget{
+		class: "L" + strings.Replace(s[:hash], ".", "/", -1) + ";",
+		name:  s[hash+1:],
+	}, nil
+}
+
+// The callers of each overload of the target, keyed by the target's display
+// name.
+type callerIndex struct {
+	targets []string
+	callers map[string][]string
+	seen    map[string]map[string]struct{}
+}
+
+func newCallerIndex() *callerIndex {
+	return &callerIndex{
+		callers: make(map[string][]string),
+		seen:    make(map[string]map[string]struct{}),
+	}
+}
+
+func (c *callerIndex) add(codeRefs []dex.CodeRefs, opts countOptions, target memberTarget) {
+	for _, refs := range codeRefs {
+		caller := opts.mapping.MethodRef(refs.Caller).JavaSignature()
+
+		for _, methodRef := range refs.MethodRefs {
+			methodRef = opts.mapping.MethodRef(methodRef)
+			if methodRef.DeclClass == target.class && methodRef.MethodName == target.name {
+				c.addCaller(methodRef.JavaSignature(), caller)
+			}
+		}
+
+		for _, fieldRef := range refs.FieldRefs {
+			fieldRef = opts.mapping.FieldRef(fieldRef)
+			if fieldRef.DeclClass == target.class && fieldRef.FieldName == target.name {
+				c.addCaller(fieldRef.Class().String()+"."+fieldRef.FieldName, caller)
+			}
+		}
+	}
+}
+
+func (c *callerIndex) addCaller(target, caller string) {
+	seen, ok := c.seen[target]
+	if !ok {
+		seen = make(map[string]struct{})
+		c.seen[target] = seen
+		c.targets = append(c.targets, target)
+	}
+
+	if _, ok := seen[caller]; ok {
+		return
+	}
+	seen[caller] = struct{}{}
+	c.callers[target] = append(c.callers[target], caller)
+}
+
+func (c *callerIndex) output(w io.Writer, target memberTarget) {
+	if len(c.targets) == 0 {
+		fmt.Fprintf(w, "No references to %s#%s\n", dex.DescriptorToDot(target.class), target.name)
+		return
+	}
+
+	for _, t := range c.targets {
+		fmt.Fprintln(w, t+" is referenced from:")
+		for _, caller := range c.callers[t] {
+			fmt.Fprintln(w, "    "+caller)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dexcount
+
+import (
+	"strings"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+)
+
+// The name of the node which anonymous and synthetic classes are counted under
+// when collapsing them.
+const anonymousNode = "<anonymous>"
+
+// Where the references to members of a class are counted.
+type nodePath struct {
+	// The dotted name, which the package filter is matched against and which
+	// flat trees are keyed by.
+	name string
+	// The names of the nodes from the root down to the counted node.
+	pieces []string
+	// How many of the last pieces name classes rather than packages. Only
+	// counted when nesting inner classes.
+	classes int
+}
+
+// Returns the path that references to members of the given class are counted
+// under.
+func (o Options) pathOf(t dex.Type) nodePath {
+	if !o.IncludeClasses && !o.NestInnerClasses && !o.CollapseAnonymous {
+		name := dex.PackageNameOnly(t.Descriptor())
+		return nodePath{name: name, pieces: strings.Split(name, ".")}
+	}
+
+	if !o.NestInnerClasses && !o.CollapseAnonymous {
+		name := strings.Replace(t.String(), "$", ".", -1)
+		return nodePath{name: name, pieces: strings.Split(name, ".")}
+	}
+
+	classes := t.Classes()
+	if classes == nil {
+		// Primitives, e.g. the clone() of an int[].
+		classes = []string{t.SimpleName()}
+	}
+	if o.CollapseAnonymous {
+		classes = collapseAnonymous(classes)
+	}
+
+	path := nodePath{
+		name:    strings.Join(classes, "$"),
+		pieces:  make([]string, 0),
+		classes: len(classes),
+	}
+	if pkg := t.Package(); pkg != "" {
+		path.name = pkg + "." + path.name
+		path.pieces = strings.Split(pkg, ".")
+	}
+	path.pieces = append(path.pieces, classes...)
+
+	return path
+}
+
+// Replaces the first anonymous or synthetic class in the chain of enclosing
+// classes, along with anything nested within it, by a single anonymous node.
+func collapseAnonymous(classes []string) []string {
+	// D8 used to name lambda classes "-$$Lambda$Outer$<hash>".
+	if lambda := strings.TrimPrefix(classes[0], dex.LegacyLambdaPrefix); lambda != classes[0] {
+		if end := strings.IndexByte(lambda, '$'); end > 0 {
+			return []string{lambda[:end], anonymousNode}
+		}
+		return []string{anonymousNode}
+	}
+
+	for i, name := range classes {
+		// Classes synthesized by D8 and R8, e.g. "Outer$$ExternalSyntheticLambda0",
+		// belong to the class before the "$$".
+		if end := strings.Index(name, "$$"); end > 0 {
+			return append(append(classes[:i:i], name[:end]), anonymousNode)
+		}
+
+		// Anonymous and local classes, e.g. "Outer$1" and "Outer$1Local", have
+		// names starting with a digit.
+		if i > 0 && name[0] >= '0' && name[0] <= '9' {
+			return append(trimMethodNames(classes[:i:i]), anonymousNode)
+		}
+	}
+
+	return classes
+}
+
+// Drops the names of enclosing methods from the end of the chain. Kotlin names
+// the anonymous classes it generates for lambdas after the method they're in,
+// e.g. "Outer$onCreate$1". The top-level class is always kept.
+func trimMethodNames(classes []string) []string {
+	end := len(classes)
+	for end > 1 && isLower(classes[end-1][0]) {
+		end--
+	}
+	return classes[:end]
+}
+
+func isLower(b byte) bool {
+	return b >= 'a' && b <= 'z'
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dexcount
+
+import (
+	"fmt"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+	"github.com/rsookram/dex-method-counts/internal/mapping"
+)
+
+// The classes defined in a dex file, along with their code. Class files don't
+// provide this.
+type classDefSource interface {
+	GetClassDefs() []dex.ClassDef
+}
+
+// Counts the bytes of bytecode in each package, rather than the number of
+// references.
+type codeSizeGenerator struct {
+	opts    Options
+	mapping *mapping.Mapping
+}
+
+func (g codeSizeGenerator) generate(d refSource, classDefs []dex.ClassDef) countState {
+	state := newCountState()
+
+	if classDefs == nil {
+		g.opts.info("Code sizes are only available for dex files.")
+		return state
+	}
+
+	methods := 0
+	for _, classDef := range classDefs {
+		for _, method := range classDef.Methods {
+			if method.Code == nil {
+				continue
+			}
+			methods++
+
+			methodRef := g.mapping.MethodRef(method.MethodRef)
+			path := g.opts.pathOf(methodRef.Class())
+			if !g.opts.matches(path) {
+				continue
+			}
+
+			kind := UserWritten
+			if g.opts.ClassifySynthetic {
+				kind = ClassifyMethod(methodRef.DeclClass, methodRef.MethodName, method.AccessFlags)
+			}
+
+			state.add(path, method.Code.InsnsBytes(), kind, g.opts)
+		}
+	}
+	g.opts.info(fmt.Sprint("Read in ", methods, " methods with code."))
+
+	return state
+}
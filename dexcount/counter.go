@@ -0,0 +1,139 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dexcount
+
+import "math"
+
+type countState struct {
+	overallCount int
+	packageTree  *Node
+	// The distinct references which were counted. Methods are keyed by
+	// dex.MethodRefKey and fields by dex.FieldRef.
+	refKeys map[interface{}]struct{}
+	// The part of overallCount from each kind of synthetic method.
+	synthetic map[SyntheticKind]int
+	kotlin    KotlinCounts
+}
+
+func newCountState() countState {
+	return countState{
+		packageTree: NewNode(),
+		refKeys:     make(map[interface{}]struct{}),
+		synthetic:   make(map[SyntheticKind]int),
+		kotlin:      newKotlinCounts(),
+	}
+}
+
+func mergeCountState(s, s2 countState) countState {
+	return countState{
+		overallCount: s.overallCount + s2.overallCount,
+		packageTree:  mergeNodes(s.packageTree, s2.packageTree),
+		refKeys:      mergeRefKeys(s.refKeys, s2.refKeys),
+		synthetic:    mergeSyntheticCounts(s.synthetic, s2.synthetic),
+		kotlin:       mergeKotlinCounts(s.kotlin, s2.kotlin),
+	}
+}
+
+func mergeSyntheticCounts(c, c2 map[SyntheticKind]int) map[SyntheticKind]int {
+	merged := make(map[SyntheticKind]int, len(c)+len(c2))
+	for kind, count := range c {
+		merged[kind] += count
+	}
+	for kind, count := range c2 {
+		merged[kind] += count
+	}
+	return merged
+}
+
+func mergeRefKeys(k, k2 map[interface{}]struct{}) map[interface{}]struct{} {
+	merged := make(map[interface{}]struct{}, len(k)+len(k2))
+	for key := range k {
+		merged[key] = struct{}{}
+	}
+	for key := range k2 {
+		merged[key] = struct{}{}
+	}
+	return merged
+}
+
+// Returns the number of distinct references counted, so that a reference
+// made from several dex files is only counted once.
+func (s countState) uniqueCount() int {
+	return len(s.refKeys)
+}
+
+// Adds amount to the count of the node at the given path. In a flat tree only
+// that node is counted, while in a nested tree every node along the path is,
+// up to the maximum depth. Amounts from synthetic methods are also added to
+// the nodes' synthetic counts.
+func (s *countState) add(path nodePath, amount int, kind SyntheticKind, opts Options) {
+	s.overallCount += amount
+
+	synthetic := 0
+	if kind != UserWritten {
+		synthetic = amount
+		s.synthetic[kind] += amount
+	}
+
+	if opts.Flat {
+		node := s.packageTree.child(path.name)
+		node.Count += amount
+		node.Synthetic += synthetic
+		node.Class = path.classes > 0
+		return
+	}
+
+	maxDepth := uint(math.MaxUint32)
+	if opts.MaxDepth != nil {
+		maxDepth = *opts.MaxDepth
+	}
+
+	firstClass := len(path.pieces) - path.classes
+	for _, pieces := range stringsSequence(path.pieces, maxDepth) {
+		addCount(s.packageTree, pieces, firstClass, amount, synthetic)
+	}
+}
+
+// Adds amount, and the synthetic part of it, to the node at the end of pieces,
+// marking the nodes from firstClass onwards as classes.
+func addCount(n *Node, pieces []string, firstClass int, amount, synthetic int) {
+	for i, name := range pieces {
+		if len(name) == 0 {
+			// This method is declared in a class that is part of the default
+			// package. Typical examples are methods that operate on arrays of
+			// primitive data types.
+			name = "<default>"
+		}
+		n = n.child(name)
+		if i >= firstClass {
+			n.Class = true
+		}
+	}
+	n.Count += amount
+	n.Synthetic += synthetic
+}
+
+func stringsSequence(strs []string, maxDepth uint) [][]string {
+	seq := make([][]string, 0)
+
+	for i := uint(0); i < uint(len(strs))+1 && i < maxDepth; i++ {
+		seq = append(seq, strs[:i])
+	}
+
+	return seq
+}
@@ -0,0 +1,279 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dexcount counts the methods, fields or bytes of bytecode in dex
+// files, APKs, app bundles, jars and aars, broken down by package.
+//
+// It provides the counting reports of the dex-method-counts command. Its other
+// reports, such as -limits and the why and deps commands, aren't part of the
+// package.
+package dexcount
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+	"github.com/rsookram/dex-method-counts/internal/input"
+	"github.com/rsookram/dex-method-counts/internal/mapping"
+)
+
+// What is counted in each input.
+type Unit int
+
+const (
+	// Method references, from the method_ids of each dex file.
+	Methods Unit = iota
+	// Field references, from the field_ids of each dex file.
+	Fields
+	// Bytes of bytecode in the methods defined by each dex file.
+	CodeBytes
+)
+
+// Which references are counted.
+type Filter int
+
+const (
+	// Every reference.
+	FilterAll Filter = iota
+	// Only references to methods or fields which are defined in the same dex
+	// file.
+	FilterDefinedOnly
+	// Only references to methods or fields which are defined elsewhere, e.g.
+	// in the framework.
+	FilterReferencedOnly
+)
+
+// Receives progress messages while inputs are counted.
+type Logger interface {
+	// Logs a progress message, e.g. the number of references read.
+	Info(msg string)
+	// Logs a detailed message.
+	Debug(msg string)
+}
+
+// Options control how inputs are counted. The zero value counts every method
+// reference, broken down by package.
+type Options struct {
+	Unit   Unit
+	Filter Filter
+
+	// Breaks the counts of each package down by class.
+	IncludeClasses bool
+	// Nests inner classes under the class which encloses them, and marks class
+	// nodes with Node.Class. Otherwise "Outer$Inner" is split like a package
+	// named "Outer.Inner". Implies IncludeClasses.
+	NestInnerClasses bool
+	// Counts anonymous classes, and classes synthesized by the compiler such
+	// as lambdas, in a single "<anonymous>" node under the class which
+	// encloses them. Implies NestInnerClasses.
+	CollapseAnonymous bool
+	// Only counts references to classes in packages starting with this prefix,
+	// e.g. "com.example".
+	PackageFilter string
+	// The number of levels in the tree, including the root, so zero only
+	// counts the totals. nil means no limit.
+	MaxDepth *uint
+	// Classifies each method as user-written or synthetic, and counts the
+	// synthetic ones in Node.Synthetic and Input.Synthetic. Doesn't apply when
+	// counting fields.
+	ClassifySynthetic bool
+	// Counts the method references which come from Kotlin language features
+	// and the Kotlin standard library in Input.Kotlin. Only applies when
+	// counting methods.
+	Kotlin bool
+	// Builds a tree with a single level, holding a child for each package
+	// named by its full name, rather than nesting packages by name segment.
+	Flat bool
+
+	// The path of an R8 or ProGuard mapping file, used to restore obfuscated
+	// names before counting. Optional.
+	MappingFile string
+
+	// Receives progress messages. Optional.
+	Logger Logger
+}
+
+// The counts of a set of inputs.
+type Report struct {
+	Inputs []Input
+	// The sum of every input's count.
+	Count int
+}
+
+// The counts of a single input file.
+type Input struct {
+	Path string
+	// The sum of the counts of the input's dex files.
+	Count int
+	// The number of distinct references, so that a reference made from
+	// several dex files is only counted once. Zero when counting code size.
+	UniqueCount int
+	// The package tree, combined across all of the input's dex files.
+	Tree *Node
+	// The part of Count from each kind of synthetic method. Only counted with
+	// ClassifySynthetic.
+	Synthetic map[SyntheticKind]int
+	// The method references from each Kotlin feature, summed across the
+	// input's dex files. Only counted with Kotlin.
+	Kotlin KotlinCounts
+	// The counts of each dex file, in the order they appear in the input. An
+	// input of class files has a single entry, named after the input.
+	DexFiles []DexFile
+}
+
+// The counts of a single dex file within an input.
+type DexFile struct {
+	// The name of the file, e.g. "classes2.dex" for an entry in an APK.
+	Name string
+	// The module the file belongs to when the input is an app bundle, e.g.
+	// "base". Empty for other inputs.
+	Module string
+	Count  int
+	Tree   *Node
+}
+
+// The combined counts of the dex files in one module of an app bundle.
+type Module struct {
+	Name  string
+	Count int
+	Tree  *Node
+}
+
+// Counts each of the inputs in turn. Inputs may be dex files, APKs, app
+// bundles, jars or aars.
+func (o Options) Count(ctx context.Context, inputs []string) (*Report, error) {
+	var m *mapping.Mapping
+	if o.MappingFile != "" {
+		var err error
+		m, err = mapping.Open(o.MappingFile)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to load mapping file. %w", err)
+		}
+		o.debug("Loaded mapping from " + o.MappingFile)
+	}
+
+	gen := newGenerator(o, m)
+
+	report := &Report{Inputs: make([]Input, 0, len(inputs))}
+	for _, path := range inputs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		o.info("Processing " + path)
+		in, err := countInput(ctx, path, gen, o)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Inputs = append(report.Inputs, in)
+		report.Count += in.Count
+	}
+
+	return report, nil
+}
+
+// Counts all of the dex files, or class files, in the given input.
+func countInput(ctx context.Context, path string, gen generator, opts Options) (Input, error) {
+	total := newCountState()
+	result := Input{Path: path}
+
+	add := func(name, module string, d refSource) {
+		state := gen.generate(d, opts.classDefs(d))
+		total = mergeCountState(total, state)
+		result.DexFiles = append(result.DexFiles, DexFile{
+			Name:   name,
+			Module: module,
+			Count:  state.overallCount,
+			Tree:   state.packageTree,
+		})
+	}
+
+	classes, err := input.OpenClassFiles(path)
+	if err != nil {
+		return result, fmt.Errorf("Failed to read class files. %w", err)
+	}
+
+	if classes != nil {
+		opts.debug(fmt.Sprintf("Loaded %d classes from %s", classes.Len(), path))
+		add(filepath.Base(path), "", classes)
+	} else {
+		err = input.ForEachDex(path, func(f input.DexFile, d *dex.Data) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			opts.debug(fmt.Sprintf("Loaded %s (dex version %03d)", f.Name, d.Version()))
+			add(f.Name, f.Module, d)
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+
+	result.Count = total.overallCount
+	result.UniqueCount = total.uniqueCount()
+	result.Tree = total.packageTree
+	result.Synthetic = total.synthetic
+	result.Kotlin = total.kotlin
+
+	return result, nil
+}
+
+// Returns the combined counts of each module, in the order that the modules
+// first appear in the input. Returns nil unless the input is an app bundle.
+func (in Input) Modules() []Module {
+	modules := make([]Module, 0)
+	index := make(map[string]int)
+
+	for _, f := range in.DexFiles {
+		if f.Module == "" {
+			continue
+		}
+
+		i, seen := index[f.Module]
+		if !seen {
+			i = len(modules)
+			index[f.Module] = i
+			modules = append(modules, Module{Name: f.Module, Tree: NewNode()})
+		}
+
+		modules[i].Count += f.Count
+		modules[i].Tree = Merge(modules[i].Tree, f.Tree)
+	}
+
+	if len(modules) == 0 {
+		return nil
+	}
+
+	return modules
+}
+
+func (o Options) info(msg string) {
+	if o.Logger != nil {
+		o.Logger.Info(msg)
+	}
+}
+
+func (o Options) debug(msg string) {
+	if o.Logger != nil {
+		o.Logger.Debug(msg)
+	}
+}
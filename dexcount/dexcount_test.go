@@ -0,0 +1,272 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dexcount
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+)
+
+// The fixtures are built by the tests of internal/dex.
+var (
+	appInput   = filepath.Join("..", "internal", "dex", "testdata", "app.dex")
+	benchInput = filepath.Join("..", "internal", "dex", "testdata", "bench.dex")
+)
+
+func depth(d uint) *uint {
+	return &d
+}
+
+// app.dex references two methods of com.example.app, two of com.example.util,
+// and one each of android.app, java.lang and okhttp3.
+func TestCount(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      Options
+		wantCount int
+		// The expected count at each path in the tree.
+		wantNodes map[string]int
+	}{
+		{
+			name:      "methods",
+			wantCount: 7,
+			wantNodes: map[string]int{
+				"com":                  4,
+				"com.example.app":      2,
+				"com.example.util":     2,
+				"android.app":          1,
+				"okhttp3":              1,
+				"com.example.app.Main": 0,
+			},
+		},
+		{
+			name:      "fields",
+			opts:      Options{Unit: Fields},
+			wantCount: 2,
+			wantNodes: map[string]int{"com.example.app": 1, "java.lang": 1},
+		},
+		{
+			name:      "classes",
+			opts:      Options{IncludeClasses: true},
+			wantCount: 7,
+			wantNodes: map[string]int{"com.example.app.MainActivity": 2},
+		},
+		{
+			name:      "package filter",
+			opts:      Options{PackageFilter: "com.example"},
+			wantCount: 4,
+			wantNodes: map[string]int{"com.example": 4, "okhttp3": 0},
+		},
+		{
+			name:      "max depth",
+			opts:      Options{MaxDepth: depth(2)},
+			wantCount: 7,
+			wantNodes: map[string]int{"com": 4, "com.example": 0},
+		},
+		{
+			name:      "zero max depth only counts totals",
+			opts:      Options{MaxDepth: depth(0)},
+			wantCount: 7,
+			wantNodes: map[string]int{"com": 0},
+		},
+		{
+			name:      "flat",
+			opts:      Options{Flat: true},
+			wantCount: 7,
+			wantNodes: map[string]int{"com.example.app": 2, "com": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := tt.opts.Count(context.Background(), []string{appInput})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if report.Count != tt.wantCount {
+				t.Errorf("Count = %d, want %d", report.Count, tt.wantCount)
+			}
+			if len(report.Inputs) != 1 {
+				t.Fatalf("got %d inputs, want 1", len(report.Inputs))
+			}
+
+			in := report.Inputs[0]
+			if in.Count != tt.wantCount {
+				t.Errorf("input Count = %d, want %d", in.Count, tt.wantCount)
+			}
+			if len(in.DexFiles) != 1 || in.DexFiles[0].Name != "app.dex" || in.DexFiles[0].Count != tt.wantCount {
+				t.Errorf("DexFiles = %+v, want a single app.dex with a count of %d", in.DexFiles, tt.wantCount)
+			}
+
+			for path, want := range tt.wantNodes {
+				pieces := strings.Split(path, ".")
+				if tt.opts.Flat {
+					pieces = []string{path}
+				}
+				if got := in.Tree.CountAt(pieces...); got != want {
+					t.Errorf("CountAt(%s) = %d, want %d", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestCountInputs(t *testing.T) {
+	report, err := (Options{}).Count(context.Background(), []string{appInput, appInput})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(report.Inputs) != 2 {
+		t.Fatalf("got %d inputs, want 2", len(report.Inputs))
+	}
+	if report.Count != 14 {
+		t.Errorf("Count = %d, want the sum of both inputs, 14", report.Count)
+	}
+}
+
+func TestCountErrors(t *testing.T) {
+	dir := t.TempDir()
+	corrupt := filepath.Join(dir, "corrupt.dex")
+	b, err := os.ReadFile(appInput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Points the string_ids past the end of the file.
+	binary.LittleEndian.PutUint32(b[0x3c:], uint32(len(b)))
+	if err := os.WriteFile(corrupt, b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = (Options{}).Count(context.Background(), []string{corrupt})
+	var formatErr *dex.FormatError
+	if !errors.As(err, &formatErr) {
+		t.Errorf("Count() of a corrupt file returned %v, want a *dex.FormatError", err)
+	}
+
+	_, err = (Options{MappingFile: filepath.Join(dir, "missing.txt")}).Count(context.Background(), []string{appInput})
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Count() with a missing mapping file returned %v, want fs.ErrNotExist", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := (Options{}).Count(ctx, []string{appInput}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Count() with a canceled context returned %v, want context.Canceled", err)
+	}
+}
+
+func TestModules(t *testing.T) {
+	tree := func(pkg string, count int) *Node {
+		n := NewNode()
+		n.Count = count
+		n.child(pkg).Count = count
+		return n
+	}
+
+	in := Input{
+		DexFiles: []DexFile{
+			{Name: "classes.dex", Module: "base", Count: 3, Tree: tree("com", 3)},
+			{Name: "classes.dex", Module: "feature", Count: 2, Tree: tree("org", 2)},
+			{Name: "classes2.dex", Module: "base", Count: 4, Tree: tree("org", 4)},
+		},
+	}
+
+	modules := in.Modules()
+	if len(modules) != 2 {
+		t.Fatalf("got %d modules, want 2", len(modules))
+	}
+
+	base, feature := modules[0], modules[1]
+	if base.Name != "base" || base.Count != 7 || base.Tree.CountAt("com") != 3 || base.Tree.CountAt("org") != 4 {
+		t.Errorf("first module = %s with %d, want base with 7 across com and org", base.Name, base.Count)
+	}
+	if feature.Name != "feature" || feature.Count != 2 || feature.Tree.CountAt("org") != 2 {
+		t.Errorf("second module = %s with %d, want feature with 2", feature.Name, feature.Count)
+	}
+
+	notBundle := Input{DexFiles: []DexFile{{Name: "classes.dex", Count: 3, Tree: tree("com", 3)}}}
+	if modules := notBundle.Modules(); modules != nil {
+		t.Errorf("Modules() of an input which isn't a bundle = %v, want nil", modules)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	a := NewNode()
+	a.Count = 5
+	a.child("org").Count = 2
+	com := a.child("com")
+	com.Count = 3
+	com.Synthetic = 1
+	com.child("Foo").Class = true
+
+	b := NewNode()
+	b.Count = 4
+	b.child("com").Count = 4
+	b.child("android").Count = 0
+
+	merged := Merge(a, b)
+
+	if merged.Count != 9 {
+		t.Errorf("Count = %d, want 9", merged.Count)
+	}
+	if got, want := merged.Names, []string{"android", "com", "org"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Names = %v, want %v", got, want)
+	}
+	if got := merged.CountAt("com"); got != 7 {
+		t.Errorf("com has %d, want 7", got)
+	}
+	if got := merged.Children["com"].Synthetic; got != 1 {
+		t.Errorf("com has %d synthetic, want 1", got)
+	}
+	if foo := merged.Children["com"].Children["Foo"]; foo == nil || !foo.Class {
+		t.Errorf("com.Foo = %+v, want a class", foo)
+	}
+	if got := merged.CountAt("org"); got != 2 {
+		t.Errorf("org has %d, want 2", got)
+	}
+
+	if a.Count != 5 || a.CountAt("com") != 3 {
+		t.Errorf("Merge() modified its input")
+	}
+
+	if empty := Merge(); empty.Count != 0 || len(empty.Children) != 0 {
+		t.Errorf("Merge() of no trees = %+v, want an empty node", empty)
+	}
+}
+
+// Counts the methods of a dex file, from reading it to building the tree.
+func BenchmarkCount(b *testing.B) {
+	ctx := context.Background()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := (Options{IncludeClasses: true}).Count(ctx, []string{benchInput}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dexcount
+
+import (
+	"fmt"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+	"github.com/rsookram/dex-method-counts/internal/mapping"
+)
+
+type fieldGenerator struct {
+	opts    Options
+	mapping *mapping.Mapping
+}
+
+func (g fieldGenerator) generate(d refSource, _ []dex.ClassDef) countState {
+	state := newCountState()
+
+	for _, fieldRef := range getFieldRefs(d, g.opts) {
+		fieldRef = g.mapping.FieldRef(fieldRef)
+
+		path := g.opts.pathOf(fieldRef.Class())
+		if !g.opts.matches(path) {
+			continue
+		}
+
+		state.refKeys[fieldRef] = struct{}{}
+		state.add(path, 1, UserWritten, g.opts)
+	}
+
+	return state
+}
+
+func getFieldRefs(dexData refSource, opts Options) []dex.FieldRef {
+	fieldRefs := dexData.GetFieldRefs()
+	opts.info(fmt.Sprint("Read in ", len(fieldRefs), " field IDs."))
+	if opts.Filter == FilterAll {
+		return fieldRefs
+	}
+
+	definedFieldRefs := map[dex.FieldRefKey]struct{}{}
+	for _, fieldRef := range dexData.GetDefinedFieldRefs() {
+		definedFieldRefs[fieldRef.Key()] = struct{}{}
+	}
+	opts.info(fmt.Sprint("Read in ", len(definedFieldRefs), " defined field references."))
+
+	filteredFieldRefs := make([]dex.FieldRef, 0)
+	for _, fieldRef := range fieldRefs {
+		_, isDefined := definedFieldRefs[fieldRef.Key()]
+		if (opts.Filter == FilterDefinedOnly && isDefined) || (opts.Filter == FilterReferencedOnly && !isDefined) {
+			filteredFieldRefs = append(filteredFieldRefs, fieldRef)
+		}
+	}
+	opts.logFiltered(len(filteredFieldRefs))
+
+	return filteredFieldRefs
+}
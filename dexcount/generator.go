@@ -0,0 +1,84 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dexcount
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+	"github.com/rsookram/dex-method-counts/internal/mapping"
+)
+
+// Counts the references of a single source. classDefs are the classes the
+// source defines, which are nil unless the source has them and counting needs
+// them.
+type generator interface {
+	generate(d refSource, classDefs []dex.ClassDef) countState
+}
+
+// The references to count, which come from either a dex file or a set of
+// class files.
+type refSource interface {
+	GetMethodRefs() []dex.MethodRef
+	GetFieldRefs() []dex.FieldRef
+	GetDefinedMethodRefs() []dex.MethodRef
+	GetDefinedFieldRefs() []dex.FieldRef
+}
+
+func newGenerator(opts Options, m *mapping.Mapping) generator {
+	switch opts.Unit {
+	case CodeBytes:
+		return codeSizeGenerator{opts: opts, mapping: m}
+	case Fields:
+		return fieldGenerator{opts: opts, mapping: m}
+	default:
+		return methodGenerator{opts: opts, mapping: m}
+	}
+}
+
+// Returns the classes defined in the source when the options need them, so
+// that they're only read once for every use. Returns nil when they aren't
+// needed, or the source doesn't have them.
+func (o Options) classDefs(d refSource) []dex.ClassDef {
+	source, ok := d.(classDefSource)
+	if !ok || !(o.Unit == CodeBytes || o.ClassifySynthetic || o.Kotlin) {
+		return nil
+	}
+	return source.GetClassDefs()
+}
+
+// Reports whether references to members of the given class pass the package
+// filter. The filter is matched against the dotted package name, or against
+// the class name when classes are included.
+func (o Options) Matches(classDescriptor string) bool {
+	return o.matches(o.pathOf(dex.TypeOf(classDescriptor)))
+}
+
+func (o Options) matches(path nodePath) bool {
+	return o.PackageFilter == "" || strings.HasPrefix(path.name, o.PackageFilter)
+}
+
+// Logs how many references remain after filtering.
+func (o Options) logFiltered(n int) {
+	if o.Filter == FilterDefinedOnly {
+		o.info(fmt.Sprint("Filtered to ", n, " defined."))
+	} else {
+		o.info(fmt.Sprint("Filtered to ", n, " referenced."))
+	}
+}
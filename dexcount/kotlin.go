@@ -0,0 +1,250 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dexcount
+
+import (
+	"strings"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+)
+
+// The Kotlin language feature, or part of the Kotlin standard library, that a
+// method reference comes from.
+type KotlinFeature int
+
+const (
+	// A method which isn't specific to Kotlin.
+	NotKotlin KotlinFeature = iota
+	// A method of kotlin.jvm.internal.Intrinsics, such as the null checks
+	// which Kotlin inserts for parameters and platform types.
+	KotlinIntrinsics
+	// Any other method in the kotlin package or its subpackages.
+	KotlinStdlib
+	// A method of a coroutine's continuation class, which holds the state
+	// machine of a suspend function or lambda.
+	KotlinCoroutine
+	// A method of a companion object, e.g. "Foo$Companion".
+	KotlinCompanion
+	// A method of a "$WhenMappings" class, which maps enum ordinals for a when
+	// expression.
+	KotlinWhenMappings
+	// A method of a "$DefaultImpls" class, which holds the bodies of interface
+	// methods with defaults when they aren't compiled as Java default methods.
+	KotlinDefaultImpls
+	// A method which fills in default arguments, e.g. "foo$default".
+	KotlinDefaultArgs
+	// A method of a file facade, e.g. "UtilsKt", which holds the top-level
+	// functions of a file. Only classes defined in the input are recognised,
+	// since a facade is told apart from a Java class ending in "Kt" by its
+	// kotlin.Metadata annotation.
+	KotlinFileFacade
+)
+
+// Every Kotlin feature, in the order they're reported.
+var KotlinFeatures = []KotlinFeature{
+	KotlinIntrinsics,
+	KotlinStdlib,
+	KotlinCoroutine,
+	KotlinCompanion,
+	KotlinWhenMappings,
+	KotlinDefaultImpls,
+	KotlinDefaultArgs,
+	KotlinFileFacade,
+}
+
+func (f KotlinFeature) String() string {
+	switch f {
+	case NotKotlin:
+		return "not-kotlin"
+	case KotlinIntrinsics:
+		return "intrinsics"
+	case KotlinStdlib:
+		return "stdlib"
+	case KotlinCoroutine:
+		return "coroutines"
+	case KotlinCompanion:
+		return "companion"
+	case KotlinWhenMappings:
+		return "when-mappings"
+	case KotlinDefaultImpls:
+		return "default-impls"
+	case KotlinDefaultArgs:
+		return "default-args"
+	case KotlinFileFacade:
+		return "file-facade"
+	default:
+		return "unknown"
+	}
+}
+
+// Reports whether methods of this feature are generated by the Kotlin
+// compiler, rather than being code that would also be needed in Java. File
+// facades only hold the functions written in a file, so they aren't. Nor are
+// references into the standard library, which are counted by
+// KotlinCounts.Stdlib instead.
+func (f KotlinFeature) IsOverhead() bool {
+	switch f {
+	case NotKotlin, KotlinIntrinsics, KotlinStdlib, KotlinFileFacade:
+		return false
+	default:
+		return true
+	}
+}
+
+// The descriptor of the annotation which the Kotlin compiler adds to every
+// class it generates.
+const kotlinMetadata = "Lkotlin/Metadata;"
+
+// The base classes of the continuations which the Kotlin compiler generates
+// for suspend functions and lambdas.
+var continuationClasses = map[string]struct{}{
+	"Lkotlin/coroutines/jvm/internal/BaseContinuationImpl;":       {},
+	"Lkotlin/coroutines/jvm/internal/ContinuationImpl;":           {},
+	"Lkotlin/coroutines/jvm/internal/RestrictedContinuationImpl;": {},
+	"Lkotlin/coroutines/jvm/internal/SuspendLambda;":              {},
+	"Lkotlin/coroutines/jvm/internal/RestrictedSuspendLambda;":    {},
+}
+
+// Classifies a method by the names of its class and itself. superClass is the
+// descriptor of the class's superclass when the class is defined in the dex,
+// and empty otherwise, in which case continuations are only recognised by
+// their invokeSuspend method. hasMetadata reports whether the class is
+// defined in the dex with a kotlin.Metadata annotation, which file facades
+// need.
+func ClassifyKotlin(classDescriptor, methodName, superClass string, hasMetadata bool) KotlinFeature {
+	t := dex.TypeOf(classDescriptor)
+	pkg := t.Package()
+	classes := t.Classes()
+	inner := ""
+	if len(classes) > 1 {
+		inner = classes[len(classes)-1]
+	}
+	_, isContinuation := continuationClasses[superClass]
+
+	switch {
+	case classDescriptor == "Lkotlin/jvm/internal/Intrinsics;":
+		return KotlinIntrinsics
+	case pkg == "kotlin" || strings.HasPrefix(pkg, "kotlin."):
+		return KotlinStdlib
+	case isContinuation, methodName == "invokeSuspend":
+		return KotlinCoroutine
+	case inner == "Companion":
+		return KotlinCompanion
+	case inner == "WhenMappings":
+		return KotlinWhenMappings
+	case inner == "DefaultImpls":
+		return KotlinDefaultImpls
+	case strings.HasSuffix(methodName, "$default"):
+		return KotlinDefaultArgs
+	case hasMetadata && len(classes) == 1 && isFileFacade(classes[0]):
+		return KotlinFileFacade
+	default:
+		return NotKotlin
+	}
+}
+
+// Reports whether a top-level class is named like a file facade, e.g.
+// "UtilsKt", or a part of a multifile facade, e.g. "UtilsKt__StringsKt".
+func isFileFacade(name string) bool {
+	return strings.HasSuffix(name, "Kt") || strings.Contains(name, "Kt__")
+}
+
+// The number of method references from each Kotlin feature, by package.
+type KotlinCounts struct {
+	// The counts of each feature, keyed by the dotted package name of the
+	// class which declares the method. Methods which aren't specific to
+	// Kotlin aren't counted.
+	Packages map[string]map[KotlinFeature]int
+}
+
+func newKotlinCounts() KotlinCounts {
+	return KotlinCounts{Packages: make(map[string]map[KotlinFeature]int)}
+}
+
+func (k KotlinCounts) add(packageName string, feature KotlinFeature, amount int) {
+	features, ok := k.Packages[packageName]
+	if !ok {
+		features = make(map[KotlinFeature]int)
+		k.Packages[packageName] = features
+	}
+	features[feature] += amount
+}
+
+func mergeKotlinCounts(k, k2 KotlinCounts) KotlinCounts {
+	merged := newKotlinCounts()
+	for _, counts := range []KotlinCounts{k, k2} {
+		for packageName, features := range counts.Packages {
+			for feature, count := range features {
+				merged.add(packageName, feature, count)
+			}
+		}
+	}
+	return merged
+}
+
+// Returns the number of method references from the given feature, across all
+// packages.
+func (k KotlinCounts) Total(feature KotlinFeature) int {
+	total := 0
+	for _, features := range k.Packages {
+		total += features[feature]
+	}
+	return total
+}
+
+// Returns the number of method references into the Kotlin standard library,
+// including its intrinsics.
+func (k KotlinCounts) Stdlib() int {
+	return k.Total(KotlinIntrinsics) + k.Total(KotlinStdlib)
+}
+
+// Returns an estimate of the number of method references that Kotlin adds,
+// i.e. those from every feature which IsOverhead. It's an upper bound, since
+// companion objects and coroutines also hold code which would be needed
+// anyway.
+func (k KotlinCounts) Overhead() int {
+	total := 0
+	for _, feature := range KotlinFeatures {
+		if feature.IsOverhead() {
+			total += k.Total(feature)
+		}
+	}
+	return total
+}
+
+// What ClassifyKotlin needs to know about a class defined in the dex.
+type kotlinClass struct {
+	superClass  string
+	hasMetadata bool
+}
+
+// Returns the superclass of each of the given classes, and whether it has
+// Kotlin metadata.
+func definedKotlinClasses(classDefs []dex.ClassDef) map[string]kotlinClass {
+	classes := make(map[string]kotlinClass)
+	for _, classDef := range classDefs {
+		class := kotlinClass{superClass: classDef.SuperClass}
+		for _, annotation := range classDef.Annotations {
+			if annotation == kotlinMetadata {
+				class.hasMetadata = true
+			}
+		}
+		classes[classDef.ClassName] = class
+	}
+	return classes
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dexcount
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassifyKotlin(t *testing.T) {
+	const foo = "Lcom/example/Foo;"
+
+	tests := []struct {
+		name        string
+		class       string
+		method      string
+		superClass  string
+		hasMetadata bool
+		want        KotlinFeature
+	}{
+		{name: "Java class", class: foo, method: "bar", want: NotKotlin},
+		{name: "Kotlin class", class: foo, method: "bar", hasMetadata: true, want: NotKotlin},
+		{name: "intrinsics", class: "Lkotlin/jvm/internal/Intrinsics;", method: "checkNotNullParameter", want: KotlinIntrinsics},
+		{name: "stdlib", class: "Lkotlin/collections/CollectionsKt;", method: "listOf", want: KotlinStdlib},
+		{name: "stdlib root package", class: "Lkotlin/Unit;", method: "<init>", want: KotlinStdlib},
+		// Only the kotlin package itself, not packages which start with it.
+		{name: "kotlinx", class: "Lkotlinx/coroutines/BuildersKt;", method: "launch", want: NotKotlin},
+		{name: "continuation", class: "Lcom/example/Foo$bar$1;", method: "create", superClass: "Lkotlin/coroutines/jvm/internal/ContinuationImpl;", want: KotlinCoroutine},
+		{name: "invokeSuspend", class: "Lcom/example/Foo$bar$1;", method: "invokeSuspend", want: KotlinCoroutine},
+		{name: "companion", class: "Lcom/example/Foo$Companion;", method: "create", want: KotlinCompanion},
+		{name: "when mappings", class: "Lcom/example/Foo$WhenMappings;", method: "<clinit>", want: KotlinWhenMappings},
+		{name: "default impls", class: "Lcom/example/Foo$DefaultImpls;", method: "bar", want: KotlinDefaultImpls},
+		{name: "default args", class: foo, method: "bar$default", want: KotlinDefaultArgs},
+		{name: "file facade", class: "Lcom/example/UtilsKt;", method: "format", hasMetadata: true, want: KotlinFileFacade},
+		{name: "multifile facade part", class: "Lcom/example/UtilsKt__StringsKt;", method: "format", hasMetadata: true, want: KotlinFileFacade},
+		// A Java class can be named like a facade, and referenced classes
+		// can't be checked for metadata.
+		{name: "Java class ending in Kt", class: "Lcom/example/JavaKt;", method: "run", want: NotKotlin},
+		{name: "nested class ending in Kt", class: "Lcom/example/Foo$BarKt;", method: "run", hasMetadata: true, want: NotKotlin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyKotlin(tt.class, tt.method, tt.superClass, tt.hasMetadata); got != tt.want {
+				t.Errorf("ClassifyKotlin(%q, %q, %q, %t) = %v, want %v", tt.class, tt.method, tt.superClass, tt.hasMetadata, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKotlinOverhead(t *testing.T) {
+	tests := []struct {
+		name         string
+		features     map[KotlinFeature]int
+		wantStdlib   int
+		wantOverhead int
+	}{
+		{
+			name:     "stdlib",
+			features: map[KotlinFeature]int{KotlinIntrinsics: 3, KotlinStdlib: 5},
+			// The standard library is counted on its own, not as overhead.
+			wantStdlib: 8,
+		},
+		{
+			name:         "generated",
+			features:     map[KotlinFeature]int{KotlinCompanion: 1, KotlinCoroutine: 2, KotlinWhenMappings: 1, KotlinDefaultImpls: 1, KotlinDefaultArgs: 4},
+			wantOverhead: 9,
+		},
+		{
+			name:     "file facades",
+			features: map[KotlinFeature]int{KotlinFileFacade: 6},
+		},
+		{
+			name:         "mixed",
+			features:     map[KotlinFeature]int{KotlinStdlib: 5, KotlinCompanion: 2, KotlinFileFacade: 1},
+			wantStdlib:   5,
+			wantOverhead: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts := newKotlinCounts()
+			for feature, count := range tt.features {
+				counts.add("com.example", feature, count)
+			}
+
+			if got := counts.Stdlib(); got != tt.wantStdlib {
+				t.Errorf("Stdlib() = %d, want %d", got, tt.wantStdlib)
+			}
+			if got := counts.Overhead(); got != tt.wantOverhead {
+				t.Errorf("Overhead() = %d, want %d", got, tt.wantOverhead)
+			}
+		})
+	}
+}
+
+// kotlin.dex has a file facade, UtilsKt, and a Java class named JavaKt, which
+// only differ in whether they have Kotlin metadata.
+func TestCountKotlin(t *testing.T) {
+	input := filepath.Join("..", "internal", "dex", "testdata", "kotlin.dex")
+
+	report, err := (Options{Kotlin: true}).Count(context.Background(), []string{input})
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := report.Inputs[0].Kotlin
+
+	want := map[string]map[KotlinFeature]int{
+		"com.example":         {KotlinCompanion: 1, KotlinDefaultArgs: 1, KotlinFileFacade: 1},
+		"kotlin.collections":  {KotlinStdlib: 1},
+		"kotlin.jvm.internal": {KotlinIntrinsics: 1},
+	}
+	if len(k.Packages) != len(want) {
+		t.Errorf("Packages = %v, want %v", k.Packages, want)
+	}
+	for pkg, features := range want {
+		for _, feature := range KotlinFeatures {
+			if got := k.Packages[pkg][feature]; got != features[feature] {
+				t.Errorf("%s has %d %v, want %d", pkg, got, feature, features[feature])
+			}
+		}
+	}
+
+	if got := k.Stdlib(); got != 2 {
+		t.Errorf("Stdlib() = %d, want 2", got)
+	}
+	if got := k.Overhead(); got != 2 {
+		t.Errorf("Overhead() = %d, want the companion and default args, 2", got)
+	}
+}
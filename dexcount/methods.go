@@ -0,0 +1,99 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dexcount
+
+import (
+	"fmt"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+	"github.com/rsookram/dex-method-counts/internal/mapping"
+)
+
+type methodGenerator struct {
+	opts    Options
+	mapping *mapping.Mapping
+}
+
+func (g methodGenerator) generate(d refSource, classDefs []dex.ClassDef) countState {
+	state := newCountState()
+
+	var flags map[dex.MethodRefKey]uint32
+	if g.opts.ClassifySynthetic {
+		flags = definedMethodFlags(classDefs)
+	}
+	var kotlinClasses map[string]kotlinClass
+	if g.opts.Kotlin {
+		kotlinClasses = definedKotlinClasses(classDefs)
+	}
+
+	for _, methodRef := range getMethodRefs(d, g.opts) {
+		accessFlags := flags[methodRef.Key()]
+		class := kotlinClasses[methodRef.DeclClass]
+		superClass := g.mapping.Type(class.superClass)
+		methodRef = g.mapping.MethodRef(methodRef)
+
+		path := g.opts.pathOf(methodRef.Class())
+		if !g.opts.matches(path) {
+			continue
+		}
+
+		kind := UserWritten
+		if g.opts.ClassifySynthetic {
+			kind = ClassifyMethod(methodRef.DeclClass, methodRef.MethodName, accessFlags)
+		}
+
+		if g.opts.Kotlin {
+			feature := ClassifyKotlin(methodRef.DeclClass, methodRef.MethodName, superClass, class.hasMetadata)
+			if feature != NotKotlin {
+				state.kotlin.add(dex.PackageNameOnly(methodRef.DeclClass), feature, 1)
+			}
+		}
+
+		state.refKeys[methodRef.Key()] = struct{}{}
+		state.add(path, 1, kind, g.opts)
+	}
+
+	return state
+}
+
+func getMethodRefs(dexData refSource, opts Options) []dex.MethodRef {
+	methodRefs := dexData.GetMethodRefs()
+	opts.info(fmt.Sprint("Read in ", len(methodRefs), " method IDs."))
+	if opts.Filter == FilterAll {
+		return methodRefs
+	}
+
+	// Methods which aren't defined by any class in the dex are references to
+	// methods elsewhere, e.g. in the framework.
+	definedMethodRefs := map[dex.MethodRefKey]struct{}{}
+	for _, methodRef := range dexData.GetDefinedMethodRefs() {
+		definedMethodRefs[methodRef.Key()] = struct{}{}
+	}
+	opts.info(fmt.Sprint("Read in ", len(definedMethodRefs), " defined method references."))
+
+	filteredMethodRefs := make([]dex.MethodRef, 0)
+	for _, methodRef := range methodRefs {
+		_, isDefined := definedMethodRefs[methodRef.Key()]
+		if (opts.Filter == FilterDefinedOnly && isDefined) || (opts.Filter == FilterReferencedOnly && !isDefined) {
+			filteredMethodRefs = append(filteredMethodRefs, methodRef)
+		}
+	}
+	opts.logFiltered(len(filteredMethodRefs))
+
+	return filteredMethodRefs
+}
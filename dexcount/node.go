@@ -0,0 +1,130 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dexcount
+
+import "sort"
+
+// A node in a package tree. The root node has the count of the whole input,
+// and each child is named after the next segment of a package name, or after a
+// class when classes are included.
+type Node struct {
+	Count int
+	// The part of Count from synthetic methods. Only counted with
+	// ClassifySynthetic.
+	Synthetic int
+	// Set when the node is a class rather than a package. Only classes counted
+	// with NestInnerClasses are marked.
+	Class bool
+	// The names of the children, in the order they should be shown.
+	Names    []string
+	Children map[string]*Node
+}
+
+func NewNode() *Node {
+	return &Node{
+		Children: make(map[string]*Node),
+	}
+}
+
+// Returns a tree combining the counts of all the given trees. Children are
+// sorted by name.
+func Merge(trees ...*Node) *Node {
+	merged := NewNode()
+	for _, tree := range trees {
+		merged = mergeNodes(merged, tree)
+	}
+	return merged
+}
+
+func mergeNodes(n, n2 *Node) *Node {
+	return &Node{
+		Count:     n.Count + n2.Count,
+		Synthetic: n.Synthetic + n2.Synthetic,
+		Class:     n.Class || n2.Class,
+		Names:     mergeNames(n.Names, n2.Names),
+		Children:  mergeChildren(n.Children, n2.Children),
+	}
+}
+
+func mergeNames(n, n2 []string) []string {
+	allNames := make([]string, 0)
+	allNames = append(allNames, n...)
+	allNames = append(allNames, n2...)
+
+	uniqueNames := make(map[string]struct{})
+	for _, name := range allNames {
+		uniqueNames[name] = struct{}{}
+	}
+
+	mergedNames := make([]string, 0)
+	for name := range uniqueNames {
+		mergedNames = append(mergedNames, name)
+	}
+	sort.Strings(mergedNames)
+
+	return mergedNames
+}
+
+func mergeChildren(c, c2 map[string]*Node) map[string]*Node {
+	merged := make(map[string]*Node)
+
+	for name, n := range c {
+		otherNode, otherContains := c2[name]
+
+		if otherContains {
+			merged[name] = mergeNodes(n, otherNode)
+		} else {
+			merged[name] = n
+		}
+	}
+
+	for name, n := range c2 {
+		_, otherContains := c[name]
+
+		// nodes contained in both are handled above
+		if !otherContains {
+			merged[name] = n
+		}
+	}
+
+	return merged
+}
+
+// Returns the count of the node at the given path of names below n, or 0 if
+// there's no such node.
+func (n *Node) CountAt(path ...string) int {
+	for _, name := range path {
+		child, ok := n.Children[name]
+		if !ok {
+			return 0
+		}
+		n = child
+	}
+	return n.Count
+}
+
+// Returns the child with the given name, adding it if it doesn't exist yet.
+func (n *Node) child(name string) *Node {
+	child, exists := n.Children[name]
+	if !exists {
+		child = NewNode()
+		n.Names = append(n.Names, name)
+		n.Children[name] = child
+	}
+	return child
+}
@@ -0,0 +1,127 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dexcount
+
+import (
+	"strings"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+)
+
+// Whether a method was written by hand, or generated by a compiler, and which
+// kind of generated method it is.
+type SyntheticKind int
+
+const (
+	// A method which appears in the source.
+	UserWritten SyntheticKind = iota
+	// The body of a lambda, e.g. "lambda$onCreate$0", or a method of a class
+	// generated for a lambda, e.g. "Foo$$ExternalSyntheticLambda0".
+	Lambda
+	// A method which gives a nested class access to a private member of its
+	// outer class, e.g. "access$000", or "-$$Nest$mfoo" from D8.
+	Accessor
+	// A Kotlin method which fills in default arguments, e.g. "foo$default".
+	DefaultArgs
+	// A method generated by R8, e.g. "$r8$clinit".
+	R8Synthetic
+	// A method of a class synthesized by D8 or R8, e.g. the backports in
+	// "Foo$$ExternalSyntheticBackport0".
+	ExternalSynthetic
+	// A bridge method generated for a covariant override or generics.
+	Bridge
+	// Any other method which its access flags mark as synthetic, e.g. an
+	// enum's "$values".
+	OtherSynthetic
+)
+
+// Every kind of synthetic method, in the order they're reported.
+var SyntheticKinds = []SyntheticKind{
+	Lambda,
+	Accessor,
+	DefaultArgs,
+	R8Synthetic,
+	ExternalSynthetic,
+	Bridge,
+	OtherSynthetic,
+}
+
+func (k SyntheticKind) String() string {
+	switch k {
+	case UserWritten:
+		return "user-written"
+	case Lambda:
+		return "lambda"
+	case Accessor:
+		return "accessor"
+	case DefaultArgs:
+		return "default-args"
+	case R8Synthetic:
+		return "r8"
+	case ExternalSynthetic:
+		return "external-synthetic"
+	case Bridge:
+		return "bridge"
+	case OtherSynthetic:
+		return "other-synthetic"
+	default:
+		return "unknown"
+	}
+}
+
+// Classifies a method by the names of its class and itself, along with its
+// access flags from class_data_item. Pass 0 for the flags of methods which
+// aren't defined in the dex, in which case only names are used.
+func ClassifyMethod(classDescriptor, methodName string, accessFlags uint32) SyntheticKind {
+	switch {
+	case strings.Contains(classDescriptor, dex.LegacyLambdaPrefix),
+		strings.Contains(classDescriptor, "$$ExternalSyntheticLambda"):
+		return Lambda
+	case strings.Contains(classDescriptor, "$$ExternalSynthetic"),
+		strings.Contains(classDescriptor, "$$InternalSynthetic"):
+		return ExternalSynthetic
+	case strings.HasPrefix(methodName, "lambda$"),
+		strings.Contains(methodName, "$lambda$"),
+		strings.HasPrefix(methodName, "$r8$lambda$"):
+		return Lambda
+	case strings.HasPrefix(methodName, "access$"),
+		strings.HasPrefix(methodName, "-$$Nest$"):
+		return Accessor
+	case strings.HasSuffix(methodName, "$default"):
+		return DefaultArgs
+	case strings.HasPrefix(methodName, "$r8$"):
+		return R8Synthetic
+	case accessFlags&dex.AccBridge != 0:
+		return Bridge
+	case accessFlags&dex.AccSynthetic != 0:
+		return OtherSynthetic
+	default:
+		return UserWritten
+	}
+}
+
+// Returns the access flags of each method defined by the given classes.
+func definedMethodFlags(classDefs []dex.ClassDef) map[dex.MethodRefKey]uint32 {
+	flags := make(map[dex.MethodRefKey]uint32)
+	for _, classDef := range classDefs {
+		for _, method := range classDef.Methods {
+			flags[method.Key()] = method.AccessFlags
+		}
+	}
+	return flags
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dexcount
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+)
+
+func TestClassifyMethod(t *testing.T) {
+	const foo = "Lcom/example/Foo;"
+
+	tests := []struct {
+		name        string
+		class       string
+		method      string
+		accessFlags uint32
+		want        SyntheticKind
+	}{
+		{name: "user-written", class: foo, method: "onCreate", want: UserWritten},
+		{name: "constructor", class: foo, method: "<init>", accessFlags: dex.AccPublic | dex.AccConstructor, want: UserWritten},
+		{name: "lambda body", class: foo, method: "lambda$onCreate$0", want: Lambda},
+		{name: "Kotlin lambda body", class: foo, method: "onCreate$lambda$0", want: Lambda},
+		{name: "R8 lambda", class: foo, method: "$r8$lambda$abc123", want: Lambda},
+		{name: "legacy lambda class", class: "Lcom/example/-$$Lambda$Foo$abc123;", method: "run", want: Lambda},
+		{name: "lambda class", class: "Lcom/example/Foo$$ExternalSyntheticLambda0;", method: "run", want: Lambda},
+		// The lambda's class takes precedence over the flags of its methods.
+		{name: "lambda class synthetic", class: "Lcom/example/Foo$$ExternalSyntheticLambda0;", method: "<init>", accessFlags: dex.AccSynthetic, want: Lambda},
+		{name: "backport", class: "Lcom/example/Foo$$ExternalSyntheticBackport0;", method: "m", want: ExternalSynthetic},
+		{name: "internal synthetic", class: "Lcom/example/Foo$$InternalSyntheticOutline0;", method: "m", want: ExternalSynthetic},
+		{name: "accessor", class: foo, method: "access$000", want: Accessor},
+		{name: "accessor with flags", class: foo, method: "access$getCount$p", accessFlags: dex.AccStatic | dex.AccSynthetic, want: Accessor},
+		{name: "nest accessor", class: foo, method: "-$$Nest$mbar", want: Accessor},
+		{name: "default args", class: foo, method: "bar$default", want: DefaultArgs},
+		{name: "R8", class: foo, method: "$r8$clinit", want: R8Synthetic},
+		{name: "bridge", class: foo, method: "compareTo", accessFlags: dex.AccPublic | dex.AccBridge | dex.AccSynthetic, want: Bridge},
+		{name: "synthetic", class: foo, method: "$values", accessFlags: dex.AccStatic | dex.AccSynthetic, want: OtherSynthetic},
+		// Without flags, e.g. for methods of other dex files, only names count.
+		{name: "bridge without flags", class: foo, method: "compareTo", want: UserWritten},
+		{name: "access without $", class: foo, method: "accessor", want: UserWritten},
+		{name: "lambda without $", class: foo, method: "lambda", want: UserWritten},
+		{name: "$ inside name", class: foo, method: "get$r8", want: UserWritten},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyMethod(tt.class, tt.method, tt.accessFlags); got != tt.want {
+				t.Errorf("ClassifyMethod(%q, %q, %#x) = %v, want %v", tt.class, tt.method, tt.accessFlags, got, tt.want)
+			}
+		})
+	}
+}
+
+// app39.dex defines a lambda body, lambda$onCreate$0, which is synthetic.
+func TestCountSynthetic(t *testing.T) {
+	input := filepath.Join("..", "internal", "dex", "testdata", "app39.dex")
+
+	for name, unit := range map[string]Unit{"methods": Methods, "code size": CodeBytes} {
+		t.Run(name, func(t *testing.T) {
+			report, err := (Options{Unit: unit, ClassifySynthetic: true, Kotlin: true}).Count(context.Background(), []string{input})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			in := report.Inputs[0]
+			if in.Synthetic[Lambda] == 0 {
+				t.Errorf("Synthetic = %v, want a count for lambdas", in.Synthetic)
+			}
+			for kind, count := range in.Synthetic {
+				if kind != Lambda && count != 0 {
+					t.Errorf("Synthetic[%v] = %d, want 0", kind, count)
+				}
+			}
+			if got := in.Tree.Children["com"].Synthetic; got != in.Synthetic[Lambda] {
+				t.Errorf("com has %d synthetic, want %d", got, in.Synthetic[Lambda])
+			}
+		})
+	}
+}
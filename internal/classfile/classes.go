@@ -0,0 +1,126 @@
+/*
+Copyright 2017 Rashad Sookram
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package classfile
+
+import (
+	"sort"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+)
+
+// A set of class files, such as the contents of a jar, which is queried the
+// same way as a dex file. Like a dex file's method_ids and field_ids, every
+// member which is declared or referenced is included once.
+type Classes struct {
+	classes []*ClassFile
+}
+
+func (c *Classes) Add(class *ClassFile) {
+	c.classes = append(c.classes, class)
+}
+
+// Returns the number of classes in the set.
+func (c *Classes) Len() int {
+	return len(c.classes)
+}
+
+func (c *Classes) GetMethodRefs() []dex.MethodRef {
+	seen := make(map[string]struct{})
+	methodRefs := make([]dex.MethodRef, 0)
+
+	add := func(refs []dex.MethodRef) {
+		for _, ref := range refs {
+			key := ref.DeclClass + "." + ref.MethodName + ref.Descriptor()
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			methodRefs = append(methodRefs, ref)
+		}
+	}
+
+	for _, class := range c.classes {
+		add(class.Methods)
+		add(class.MethodRefs)
+	}
+
+	// Match the order of method_ids.
+	sort.Slice(methodRefs, func(i, j int) bool {
+		a, b := methodRefs[i], methodRefs[j]
+		if a.DeclClass != b.DeclClass {
+			return a.DeclClass < b.DeclClass
+		}
+		if a.MethodName != b.MethodName {
+			return a.MethodName < b.MethodName
+		}
+		return a.Descriptor() < b.Descriptor()
+	})
+
+	return methodRefs
+}
+
+func (c *Classes) GetFieldRefs() []dex.FieldRef {
+	seen := make(map[dex.FieldRefKey]struct{})
+	fieldRefs := make([]dex.FieldRef, 0)
+
+	add := func(refs []dex.FieldRef) {
+		for _, ref := range refs {
+			if _, ok := seen[ref.Key()]; ok {
+				continue
+			}
+			seen[ref.Key()] = struct{}{}
+			fieldRefs = append(fieldRefs, ref)
+		}
+	}
+
+	for _, class := range c.classes {
+		add(class.Fields)
+		add(class.FieldRefs)
+	}
+
+	// Match the order of field_ids.
+	sort.Slice(fieldRefs, func(i, j int) bool {
+		a, b := fieldRefs[i], fieldRefs[j]
+		if a.DeclClass != b.DeclClass {
+			return a.DeclClass < b.DeclClass
+		}
+		if a.FieldName != b.FieldName {
+			return a.FieldName < b.FieldName
+		}
+		return a.FieldType < b.FieldType
+	})
+
+	return fieldRefs
+}
+
+// Returns the methods which are declared by a class in the set.
+func (c *Classes) GetDefinedMethodRefs() []dex.MethodRef {
+	methodRefs := make([]dex.MethodRef, 0)
+	for _, class := range c.classes {
+		methodRefs = append(methodRefs, class.Methods...)
+	}
+	return methodRefs
+}
+
+// Returns the fields which are declared by a class in the set.
+func (c *Classes) GetDefinedFieldRefs() []dex.FieldRef {
+	fieldRefs := make([]dex.FieldRef, 0)
+	for _, class := range c.classes {
+		fieldRefs = append(fieldRefs, class.Fields...)
+	}
+	return fieldRefs
+}
@@ -0,0 +1,378 @@
+/*
+Copyright 2017 Rashad Sookram
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package classfile reads the constant pool and members of JVM class files,
+// so that the methods in a jar can be counted before it is dexed.
+package classfile
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+	"github.com/rsookram/dex-method-counts/mutf8"
+)
+
+const classFileMagic = 0xCAFEBABE
+
+// Constant pool tags.
+const (
+	constantUtf8               = 1
+	constantInteger            = 3
+	constantFloat              = 4
+	constantLong               = 5
+	constantDouble             = 6
+	constantClass              = 7
+	constantString             = 8
+	constantFieldref           = 9
+	constantMethodref          = 10
+	constantInterfaceMethodref = 11
+	constantNameAndType        = 12
+	constantMethodHandle       = 15
+	constantMethodType         = 16
+	constantDynamic            = 17
+	constantInvokeDynamic      = 18
+	constantModule             = 19
+	constantPackage            = 20
+)
+
+// Data extracted from a class file.
+type ClassFile struct {
+	// The type descriptor of the class, e.g. "Lcom/example/Foo;".
+	Name string
+
+	// The methods and fields declared by the class.
+	Methods []dex.MethodRef
+	Fields  []dex.FieldRef
+
+	// The methods and fields referenced from the constant pool, including
+	// references to the class's own members.
+	MethodRefs []dex.MethodRef
+	FieldRefs  []dex.FieldRef
+}
+
+// Holds a single constant pool entry. Only the parts used to resolve member
+// references are kept.
+type constant struct {
+	tag int
+	// The value of a CONSTANT_Utf8, decoded from Modified UTF-8.
+	utf8 string
+	// Indices into the constant pool. For a CONSTANT_Class, index1 is the name.
+	// For a ref, index1 is the class and index2 the CONSTANT_NameAndType. For a
+	// CONSTANT_NameAndType, index1 is the name and index2 the descriptor.
+	index1 int
+	index2 int
+}
+
+type reader struct {
+	r   *bufio.Reader
+	err error
+}
+
+func (r *reader) read(n int) []byte {
+	buf := make([]byte, n)
+	if r.err != nil {
+		return buf
+	}
+
+	_, r.err = io.ReadFull(r.r, buf)
+	return buf
+}
+
+func (r *reader) u1() int {
+	return int(r.read(1)[0])
+}
+
+func (r *reader) u2() int {
+	return int(binary.BigEndian.Uint16(r.read(2)))
+}
+
+func (r *reader) u4() uint32 {
+	return binary.BigEndian.Uint32(r.read(4))
+}
+
+// Parses a class file.
+func Parse(in io.Reader) (*ClassFile, error) {
+	r := &reader{r: bufio.NewReader(in)}
+
+	if r.u4() != classFileMagic {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, errors.New("wrong magic number")
+	}
+
+	// minor_version, major_version
+	r.u2()
+	r.u2()
+
+	pool, err := readConstantPool(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// access_flags
+	r.u2()
+
+	c := &ClassFile{}
+
+	c.Name, err = pool.className(r.u2())
+	if err != nil {
+		return nil, err
+	}
+
+	// super_class
+	r.u2()
+
+	interfacesCount := r.u2()
+	for i := 0; i < interfacesCount; i++ {
+		r.u2()
+	}
+
+	fieldsCount := r.u2()
+	for i := 0; i < fieldsCount; i++ {
+		name, descriptor, err := readMember(r, pool)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Fields = append(c.Fields, dex.FieldRef{
+			DeclClass: c.Name,
+			FieldType: descriptor,
+			FieldName: name,
+		})
+	}
+
+	methodsCount := r.u2()
+	for i := 0; i < methodsCount; i++ {
+		name, descriptor, err := readMember(r, pool)
+		if err != nil {
+			return nil, err
+		}
+
+		m, err := newMethodRef(c.Name, name, descriptor)
+		if err != nil {
+			return nil, err
+		}
+		c.Methods = append(c.Methods, m)
+	}
+
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if err := c.resolveRefs(pool); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+type constantPool []constant
+
+// Reads the constant pool. Entries are 1-indexed, and long and double
+// constants take up two slots, so the returned slice has unused entries.
+func readConstantPool(r *reader) (constantPool, error) {
+	count := r.u2()
+	pool := make(constantPool, count)
+
+	for i := 1; i < count; i++ {
+		c := constant{tag: r.u1()}
+
+		switch c.tag {
+		case constantUtf8:
+			length := r.u2()
+			utf8, err := mutf8.Decode(r.read(length))
+			if err != nil && r.err == nil {
+				return nil, fmt.Errorf("constant pool index %d: %v", i, err)
+			}
+			c.utf8 = utf8
+		case constantInteger, constantFloat:
+			r.u4()
+		case constantLong, constantDouble:
+			r.u4()
+			r.u4()
+		case constantClass, constantString, constantMethodType, constantModule, constantPackage:
+			c.index1 = r.u2()
+		case constantFieldref, constantMethodref, constantInterfaceMethodref,
+			constantNameAndType, constantDynamic, constantInvokeDynamic:
+			c.index1 = r.u2()
+			c.index2 = r.u2()
+		case constantMethodHandle:
+			r.u1()
+			c.index1 = r.u2()
+		default:
+			if r.err != nil {
+				return nil, r.err
+			}
+			return nil, fmt.Errorf("unknown constant pool tag %d at index %d", c.tag, i)
+		}
+
+		if r.err != nil {
+			return nil, r.err
+		}
+
+		pool[i] = c
+		if c.tag == constantLong || c.tag == constantDouble {
+			i++
+		}
+	}
+
+	return pool, nil
+}
+
+func (p constantPool) get(idx, tag int) (constant, error) {
+	if idx <= 0 || idx >= len(p) || p[idx].tag != tag {
+		return constant{}, fmt.Errorf("constant pool index %d is not of type %d", idx, tag)
+	}
+	return p[idx], nil
+}
+
+func (p constantPool) utf8(idx int) (string, error) {
+	c, err := p.get(idx, constantUtf8)
+	return c.utf8, err
+}
+
+// Returns the type descriptor of the CONSTANT_Class at the given index.
+func (p constantPool) className(idx int) (string, error) {
+	c, err := p.get(idx, constantClass)
+	if err != nil {
+		return "", err
+	}
+
+	name, err := p.utf8(c.index1)
+	if err != nil {
+		return "", err
+	}
+
+	return internalNameToDescriptor(name), nil
+}
+
+// Returns the name and descriptor of the CONSTANT_NameAndType at the given
+// index.
+func (p constantPool) nameAndType(idx int) (string, string, error) {
+	c, err := p.get(idx, constantNameAndType)
+	if err != nil {
+		return "", "", err
+	}
+
+	name, err := p.utf8(c.index1)
+	if err != nil {
+		return "", "", err
+	}
+
+	descriptor, err := p.utf8(c.index2)
+	return name, descriptor, err
+}
+
+// Collects the field and method references in the constant pool.
+func (c *ClassFile) resolveRefs(pool constantPool) error {
+	for _, entry := range pool {
+		if entry.tag != constantFieldref && entry.tag != constantMethodref && entry.tag != constantInterfaceMethodref {
+			continue
+		}
+
+		class, err := pool.className(entry.index1)
+		if err != nil {
+			return err
+		}
+
+		name, descriptor, err := pool.nameAndType(entry.index2)
+		if err != nil {
+			return err
+		}
+
+		if entry.tag == constantFieldref {
+			c.FieldRefs = append(c.FieldRefs, dex.FieldRef{
+				DeclClass: class,
+				FieldType: descriptor,
+				FieldName: name,
+			})
+			continue
+		}
+
+		m, err := newMethodRef(class, name, descriptor)
+		if err != nil {
+			return err
+		}
+		c.MethodRefs = append(c.MethodRefs, m)
+	}
+
+	return nil
+}
+
+// Reads a field_info or method_info, returning its name and descriptor.
+// Attributes are skipped.
+func readMember(r *reader, pool constantPool) (string, string, error) {
+	// access_flags
+	r.u2()
+
+	nameIdx := r.u2()
+	descriptorIdx := r.u2()
+
+	attributesCount := r.u2()
+	for i := 0; i < attributesCount; i++ {
+		// attribute_name_index
+		r.u2()
+		length := r.u4()
+		if _, err := r.r.Discard(int(length)); err != nil && r.err == nil {
+			r.err = err
+		}
+	}
+
+	if r.err != nil {
+		return "", "", r.err
+	}
+
+	name, err := pool.utf8(nameIdx)
+	if err != nil {
+		return "", "", err
+	}
+
+	descriptor, err := pool.utf8(descriptorIdx)
+	return name, descriptor, err
+}
+
+// Converts the name in a CONSTANT_Class, e.g. "java/lang/String", to a type
+// descriptor. Array classes are already named by their descriptor.
+func internalNameToDescriptor(name string) string {
+	if len(name) > 0 && name[0] == '[' {
+		return name
+	}
+	return "L" + name + ";"
+}
+
+func newMethodRef(class, name, descriptor string) (dex.MethodRef, error) {
+	params, ret, err := dex.ParseMethodDescriptor(descriptor)
+	if err != nil {
+		return dex.MethodRef{}, err
+	}
+
+	args := make([]string, len(params))
+	for i, param := range params {
+		args[i] = param.Descriptor()
+	}
+
+	return dex.MethodRef{
+		DeclClass:  class,
+		ArgTypes:   args,
+		ReturnType: ret.Descriptor(),
+		MethodName: name,
+	}, nil
+}
@@ -0,0 +1,211 @@
+/*
+Copyright 2017 Rashad Sookram
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package classfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+)
+
+// Appends big-endian values to a class file being built.
+type classWriter struct {
+	buf []byte
+}
+
+func (w *classWriter) u1(v int) {
+	w.buf = append(w.buf, byte(v))
+}
+
+func (w *classWriter) u2(v int) {
+	w.buf = binary.BigEndian.AppendUint16(w.buf, uint16(v))
+}
+
+func (w *classWriter) u4(v uint32) {
+	w.buf = binary.BigEndian.AppendUint32(w.buf, v)
+}
+
+func (w *classWriter) utf8(s string) {
+	w.u1(constantUtf8)
+	w.u2(len(s))
+	w.buf = append(w.buf, s...)
+}
+
+// Builds the class file for
+//
+//	class Foo {
+//	    int count;
+//	    Foo() { super(); }
+//	    native double run(long, String[]);
+//	}
+//
+// with a constant pool which also holds every other kind of constant. The
+// long and double constants come before the entries which are referenced, so
+// that those are only found if each of them takes two slots.
+func fooClass() []byte {
+	w := &classWriter{}
+	w.u4(classFileMagic)
+	w.u2(0)  // minor_version
+	w.u2(52) // major_version
+
+	w.u2(30)                  // constant_pool_count
+	w.utf8("com/example/Foo") // 1
+	w.u1(constantClass)       // 2
+	w.u2(1)
+	w.u1(constantLong) // 3 and 4
+	w.u4(0)
+	w.u4(42)
+	w.utf8("java/lang/Object") // 5
+	w.u1(constantClass)        // 6
+	w.u2(5)
+	w.u1(constantDouble) // 7 and 8
+	w.u4(0x40091eb8)
+	w.u4(0x51eb851f)
+	w.utf8("count")           // 9
+	w.utf8("I")               // 10
+	w.u1(constantNameAndType) // 11
+	w.u2(9)
+	w.u2(10)
+	w.u1(constantFieldref) // 12
+	w.u2(2)
+	w.u2(11)
+	w.utf8("<init>")          // 13
+	w.utf8("()V")             // 14
+	w.u1(constantNameAndType) // 15
+	w.u2(13)
+	w.u2(14)
+	w.u1(constantMethodref) // 16
+	w.u2(6)
+	w.u2(15)
+	w.u1(constantInteger) // 17
+	w.u4(7)
+	w.u1(constantString) // 18
+	w.u2(9)
+	w.utf8("run")                     // 19
+	w.utf8("(J[Ljava/lang/String;)D") // 20
+	w.u1(constantNameAndType)         // 21
+	w.u2(19)
+	w.u2(20)
+	w.u1(constantInterfaceMethodref) // 22
+	w.u2(24)
+	w.u2(21)
+	w.utf8("java/lang/Runnable") // 23
+	w.u1(constantClass)          // 24
+	w.u2(23)
+	w.u1(constantMethodHandle) // 25
+	w.u1(6)
+	w.u2(16)
+	w.u1(constantMethodType) // 26
+	w.u2(14)
+	w.u1(constantInvokeDynamic) // 27
+	w.u2(0)
+	w.u2(15)
+	w.u1(constantFloat) // 28
+	w.u4(0x3f800000)
+	w.utf8("Code") // 29
+
+	w.u2(0)  // access_flags
+	w.u2(2)  // this_class
+	w.u2(6)  // super_class
+	w.u2(1)  // interfaces_count
+	w.u2(24) // Runnable
+
+	w.u2(1) // fields_count
+	w.u2(0) // access_flags
+	w.u2(9)
+	w.u2(10)
+	w.u2(0) // attributes_count
+
+	w.u2(2) // methods_count
+	w.u2(0) // access_flags
+	w.u2(13)
+	w.u2(14)
+	w.u2(1) // attributes_count
+	w.u2(29)
+	w.u4(5)
+	w.buf = append(w.buf, 1, 2, 3, 4, 5)
+	w.u2(0x100) // access_flags
+	w.u2(19)
+	w.u2(20)
+	w.u2(0) // attributes_count
+
+	return w.buf
+}
+
+func TestParse(t *testing.T) {
+	c, err := Parse(bytes.NewReader(fooClass()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const foo = "Lcom/example/Foo;"
+	count := dex.FieldRef{DeclClass: foo, FieldType: "I", FieldName: "count"}
+	want := &ClassFile{
+		Name:   foo,
+		Fields: []dex.FieldRef{count},
+		Methods: []dex.MethodRef{
+			{DeclClass: foo, MethodName: "<init>", ArgTypes: []string{}, ReturnType: "V"},
+			{DeclClass: foo, MethodName: "run", ArgTypes: []string{"J", "[Ljava/lang/String;"}, ReturnType: "D"},
+		},
+		FieldRefs: []dex.FieldRef{count},
+		MethodRefs: []dex.MethodRef{
+			{DeclClass: "Ljava/lang/Object;", MethodName: "<init>", ArgTypes: []string{}, ReturnType: "V"},
+			{DeclClass: "Ljava/lang/Runnable;", MethodName: "run", ArgTypes: []string{"J", "[Ljava/lang/String;"}, ReturnType: "D"},
+		},
+	}
+
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Parse() = %+v, want %+v", c, want)
+	}
+}
+
+func TestParseUnknownTag(t *testing.T) {
+	w := &classWriter{}
+	w.u4(classFileMagic)
+	w.u2(0)
+	w.u2(52)
+	w.u2(3)
+	w.utf8("Foo")
+	w.u1(2) // unused tag
+
+	_, err := Parse(bytes.NewReader(w.buf))
+	if err == nil || err.Error() != "unknown constant pool tag 2 at index 2" {
+		t.Errorf("Parse() error = %v, want an unknown tag error", err)
+	}
+}
+
+func TestParseWrongMagic(t *testing.T) {
+	buf := fooClass()
+	buf[0] = 0
+
+	if _, err := Parse(bytes.NewReader(buf)); err == nil || err.Error() != "wrong magic number" {
+		t.Errorf("Parse() error = %v, want a wrong magic number error", err)
+	}
+}
+
+func TestParseTruncated(t *testing.T) {
+	buf := fooClass()
+
+	for n := 0; n < len(buf); n++ {
+		if c, err := Parse(bytes.NewReader(buf[:n])); err == nil {
+			t.Fatalf("Parse() of the first %d bytes = %+v, want an error", n, c)
+		}
+	}
+}
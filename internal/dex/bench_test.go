@@ -17,8 +17,35 @@ limitations under the License.
 
 package dex
 
-type ClassRef struct {
-	ClassName  string
-	FieldRefs  []FieldRef
-	MethodRefs []MethodRef
+import "testing"
+
+func BenchmarkParse(b *testing.B) {
+	buf := readFixture(b, "bench.dex")
+	b.SetBytes(int64(len(buf)))
+
+	for i := 0; i < b.N; i++ {
+		if _, err := Parse(buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// Parses the file and then resolves everything the tool's reports use.
+func BenchmarkParseAndResolve(b *testing.B) {
+	buf := readFixture(b, "bench.dex")
+	b.SetBytes(int64(len(buf)))
+
+	for i := 0; i < b.N; i++ {
+		d, err := Parse(buf)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		d.GetMethodRefs()
+		d.GetFieldRefs()
+		d.GetClassDefs()
+		if _, err := d.GetCodeRefs(); err != nil {
+			b.Fatal(err)
+		}
+	}
 }
@@ -0,0 +1,632 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"hash/adler32"
+	"sort"
+
+	"github.com/rsookram/dex-method-counts/mutf8"
+)
+
+// Describes a DEX file for tests to build. Only the sections which the parser
+// reads are written: the ID sections, class defs with their class data, code
+// and annotations, call sites and method handles, type lists, string data and
+// the map_list.
+type testDex struct {
+	// The format version, e.g. 35. Zero means 35.
+	version int
+	classes []testClass
+	// Members which are referenced without being defined by a class.
+	methodRefs []MethodRef
+	fieldRefs  []FieldRef
+	callSites  []testCallSite
+}
+
+// A call site for invoke-custom. Its bootstrap method is passed the name and
+// type of the call site, followed by a method handle for each of handles, e.g.
+// the body of a lambda. Every method handle written is an invoke-static one.
+type testCallSite struct {
+	bootstrap MethodRef
+	name      string
+	// Only the ArgTypes and ReturnType are used.
+	methodType MethodRef
+	handles    []MethodRef
+}
+
+type testClass struct {
+	name string
+	// Empty for a class with no superclass.
+	superClass string
+	fields     []FieldRef
+	methods    []testMethod
+	// The types of the annotations on the class, which are written without
+	// any elements.
+	annotations []string
+}
+
+type testMethod struct {
+	MethodRef
+	accessFlags uint32
+	// The code of the method invokes each of calls, then the call site at each
+	// index of customCalls, then loads a method handle for each of handles,
+	// then reads each of gets, then returns. Abstract methods have no code.
+	calls       []MethodRef
+	customCalls []int
+	handles     []MethodRef
+	gets        []FieldRef
+}
+
+type testProto struct {
+	shorty     string
+	returnType string
+	params     []string
+}
+
+func (p testProto) key() string {
+	return "(" + fmt.Sprint(p.params) + ")" + p.returnType
+}
+
+// Writes the DEX file, with a valid checksum and signature.
+func (t testDex) build() []byte {
+	b := newTestDexBuilder(t)
+	return b.write()
+}
+
+type testDexBuilder struct {
+	dex testDex
+
+	strings []string
+	types   []string
+	protos  []testProto
+	fields  []FieldRef
+	methods []MethodRef
+	handles []MethodRef
+
+	stringIdx map[string]int
+	typeIdx   map[string]int
+	protoIdx  map[string]int
+	fieldIdx  map[FieldRef]int
+	methodIdx map[MethodRefKey]int
+	handleIdx map[MethodRefKey]int
+}
+
+func newTestDexBuilder(t testDex) *testDexBuilder {
+	b := &testDexBuilder{dex: t}
+
+	strings := make(map[string]bool)
+	types := make(map[string]bool)
+	protos := make(map[string]testProto)
+	fields := make(map[FieldRef]bool)
+	methods := make(map[MethodRefKey]MethodRef)
+
+	addType := func(t string) {
+		types[t] = true
+		strings[t] = true
+	}
+	addField := func(f FieldRef) {
+		addType(f.DeclClass)
+		addType(f.FieldType)
+		strings[f.FieldName] = true
+		fields[f] = true
+	}
+	addProto := func(m MethodRef) {
+		p := protoOf(m)
+		strings[p.shorty] = true
+		addType(p.returnType)
+		for _, param := range p.params {
+			addType(param)
+		}
+		protos[p.key()] = p
+	}
+	addMethod := func(m MethodRef) {
+		addType(m.DeclClass)
+		strings[m.MethodName] = true
+		addProto(m)
+		methods[m.Key()] = m
+	}
+	b.handleIdx = make(map[MethodRefKey]int)
+	addHandle := func(m MethodRef) {
+		addMethod(m)
+		if _, ok := b.handleIdx[m.Key()]; !ok {
+			b.handleIdx[m.Key()] = len(b.handles)
+			b.handles = append(b.handles, m)
+		}
+	}
+
+	for _, c := range t.classes {
+		addType(c.name)
+		if c.superClass != "" {
+			addType(c.superClass)
+		}
+		for _, a := range c.annotations {
+			addType(a)
+		}
+		for _, f := range c.fields {
+			addField(f)
+		}
+		for _, m := range c.methods {
+			addMethod(m.MethodRef)
+			for _, call := range m.calls {
+				addMethod(call)
+			}
+			for _, h := range m.handles {
+				addHandle(h)
+			}
+			for _, get := range m.gets {
+				addField(get)
+			}
+		}
+	}
+	for _, m := range t.methodRefs {
+		addMethod(m)
+	}
+	for _, f := range t.fieldRefs {
+		addField(f)
+	}
+	for _, cs := range t.callSites {
+		addHandle(cs.bootstrap)
+		strings[cs.name] = true
+		addProto(cs.methodType)
+		for _, h := range cs.handles {
+			addHandle(h)
+		}
+	}
+
+	// Each section is sorted as the format requires. Go compares strings by
+	// their UTF-8 bytes, which matches UTF-16 order for the BMP.
+	for s := range strings {
+		b.strings = append(b.strings, s)
+	}
+	sort.Strings(b.strings)
+	b.stringIdx = indexOf(b.strings)
+
+	for t := range types {
+		b.types = append(b.types, t)
+	}
+	sort.Strings(b.types)
+	b.typeIdx = indexOf(b.types)
+
+	for _, p := range protos {
+		b.protos = append(b.protos, p)
+	}
+	sort.Slice(b.protos, func(i, j int) bool {
+		pi, pj := b.protos[i], b.protos[j]
+		if pi.returnType != pj.returnType {
+			return b.typeIdx[pi.returnType] < b.typeIdx[pj.returnType]
+		}
+		for k := 0; k < len(pi.params) && k < len(pj.params); k++ {
+			if pi.params[k] != pj.params[k] {
+				return b.typeIdx[pi.params[k]] < b.typeIdx[pj.params[k]]
+			}
+		}
+		return len(pi.params) < len(pj.params)
+	})
+	b.protoIdx = make(map[string]int)
+	for i, p := range b.protos {
+		b.protoIdx[p.key()] = i
+	}
+
+	for f := range fields {
+		b.fields = append(b.fields, f)
+	}
+	sort.Slice(b.fields, func(i, j int) bool {
+		fi, fj := b.fields[i], b.fields[j]
+		if fi.DeclClass != fj.DeclClass {
+			return fi.DeclClass < fj.DeclClass
+		}
+		if fi.FieldName != fj.FieldName {
+			return fi.FieldName < fj.FieldName
+		}
+		return fi.FieldType < fj.FieldType
+	})
+	b.fieldIdx = make(map[FieldRef]int)
+	for i, f := range b.fields {
+		b.fieldIdx[f] = i
+	}
+
+	for _, m := range methods {
+		b.methods = append(b.methods, m)
+	}
+	sort.Slice(b.methods, func(i, j int) bool {
+		mi, mj := b.methods[i], b.methods[j]
+		if mi.DeclClass != mj.DeclClass {
+			return mi.DeclClass < mj.DeclClass
+		}
+		if mi.MethodName != mj.MethodName {
+			return mi.MethodName < mj.MethodName
+		}
+		return b.protoIdx[protoOf(mi).key()] < b.protoIdx[protoOf(mj).key()]
+	})
+	b.methodIdx = make(map[MethodRefKey]int)
+	for i, m := range b.methods {
+		b.methodIdx[m.Key()] = i
+	}
+
+	return b
+}
+
+func indexOf(values []string) map[string]int {
+	idx := make(map[string]int, len(values))
+	for i, v := range values {
+		idx[v] = i
+	}
+	return idx
+}
+
+func protoOf(m MethodRef) testProto {
+	shortyChar := func(t string) string {
+		if t[0] == 'L' || t[0] == '[' {
+			return "L"
+		}
+		return t[:1]
+	}
+
+	shorty := shortyChar(m.ReturnType)
+	for _, arg := range m.ArgTypes {
+		shorty += shortyChar(arg)
+	}
+
+	return testProto{shorty: shorty, returnType: m.ReturnType, params: m.ArgTypes}
+}
+
+func (b *testDexBuilder) write() []byte {
+	le := binary.LittleEndian
+	u16 := func(buf []byte, v int) []byte { return le.AppendUint16(buf, uint16(v)) }
+	u32 := func(buf []byte, v int) []byte { return le.AppendUint32(buf, uint32(v)) }
+	uleb := func(buf []byte, v int) []byte {
+		for v >= 0x80 {
+			buf = append(buf, byte(v&0x7f|0x80))
+			v >>= 7
+		}
+		return append(buf, byte(v))
+	}
+
+	const headerSize = 0x70
+	stringIdsOff := headerSize
+	typeIdsOff := stringIdsOff + 4*len(b.strings)
+	protoIdsOff := typeIdsOff + 4*len(b.types)
+	fieldIdsOff := protoIdsOff + 12*len(b.protos)
+	methodIdsOff := fieldIdsOff + 8*len(b.fields)
+	classDefsOff := methodIdsOff + 8*len(b.methods)
+	callSiteIdsOff := classDefsOff + 32*len(b.dex.classes)
+	methodHandlesOff := callSiteIdsOff + 4*len(b.dex.callSites)
+	dataOff := methodHandlesOff + 8*len(b.handles)
+
+	// The data section is built separately, and placed after the ID sections.
+	var data []byte
+	align := func() {
+		for (dataOff+len(data))%4 != 0 {
+			data = append(data, 0)
+		}
+	}
+
+	// code_items, keyed by class and method index.
+	codeStart := dataOff + len(data)
+	codeOffs := make(map[[2]int]int)
+	for ci, c := range b.dex.classes {
+		for mi, m := range c.methods {
+			if m.accessFlags&(AccAbstract|AccNative) != 0 {
+				continue
+			}
+
+			var insns []int
+			for _, call := range m.calls {
+				// invoke-static {}, meth@BBBB
+				insns = append(insns, 0x0071, b.methodIdx[call.Key()], 0)
+			}
+			for _, cs := range m.customCalls {
+				// invoke-custom {}, call_site@BBBB
+				insns = append(insns, 0x00fc, cs, 0)
+			}
+			for _, h := range m.handles {
+				// const-method-handle v0, method_handle@BBBB
+				insns = append(insns, 0x00fe, b.handleIdx[h.Key()])
+			}
+			for _, get := range m.gets {
+				// sget v0, field@BBBB
+				insns = append(insns, 0x0060, b.fieldIdx[get])
+			}
+			// return-void
+			insns = append(insns, 0x000e)
+
+			align()
+			codeOffs[[2]int{ci, mi}] = dataOff + len(data)
+			data = u16(data, 1) // registers_size
+			data = u16(data, 0) // ins_size
+			data = u16(data, 0) // outs_size
+			data = u16(data, 0) // tries_size
+			data = u32(data, 0) // debug_info_off
+			data = u32(data, len(insns))
+			for _, insn := range insns {
+				data = u16(data, insn)
+			}
+		}
+	}
+
+	align()
+	typeListStart := dataOff + len(data)
+	typeListOffs := make([]int, len(b.protos))
+	typeLists := 0
+	for i, p := range b.protos {
+		if len(p.params) == 0 {
+			continue
+		}
+		align()
+		typeListOffs[i] = dataOff + len(data)
+		typeLists++
+		data = u32(data, len(p.params))
+		for _, param := range p.params {
+			data = u16(data, b.typeIdx[param])
+		}
+	}
+
+	stringDataStart := dataOff + len(data)
+	stringDataOffs := make([]int, len(b.strings))
+	for i, s := range b.strings {
+		stringDataOffs[i] = dataOff + len(data)
+		data = uleb(data, mutf8.UTF16Len(s))
+		data = append(data, mutf8.Encode(s)...)
+		data = append(data, 0)
+	}
+
+	// A call_site_item is an encoded_array_item, holding encoded_values which
+	// each have a header byte followed by an index in as few bytes as it needs.
+	encodedIndex := func(buf []byte, valueType, idx int) []byte {
+		size := 1
+		for idx>>(8*size) != 0 {
+			size++
+		}
+		buf = append(buf, byte((size-1)<<5|valueType))
+		for i := 0; i < size; i++ {
+			buf = append(buf, byte(idx>>(8*i)))
+		}
+		return buf
+	}
+	callSitesStart := dataOff + len(data)
+	callSiteOffs := make([]int, len(b.dex.callSites))
+	for i, cs := range b.dex.callSites {
+		callSiteOffs[i] = dataOff + len(data)
+		data = uleb(data, 3+len(cs.handles))
+		data = encodedIndex(data, valueMethodHandle, b.handleIdx[cs.bootstrap.Key()])
+		data = encodedIndex(data, valueString, b.stringIdx[cs.name])
+		data = encodedIndex(data, valueMethodType, b.protoIdx[protoOf(cs.methodType).key()])
+		for _, h := range cs.handles {
+			data = encodedIndex(data, valueMethodHandle, b.handleIdx[h.Key()])
+		}
+	}
+
+	classDataStart := dataOff + len(data)
+	classDataOffs := make([]int, len(b.dex.classes))
+	for ci, c := range b.dex.classes {
+		classDataOffs[ci] = dataOff + len(data)
+
+		fields := make([]int, len(c.fields))
+		for i, f := range c.fields {
+			fields[i] = b.fieldIdx[f]
+		}
+		sort.Ints(fields)
+
+		var direct, virtual []int
+		for mi, m := range c.methods {
+			if m.accessFlags&(AccStatic|AccPrivate|AccConstructor) != 0 {
+				direct = append(direct, mi)
+			} else {
+				virtual = append(virtual, mi)
+			}
+		}
+		for _, methods := range [][]int{direct, virtual} {
+			sort.Slice(methods, func(i, j int) bool {
+				return b.methodIdx[c.methods[methods[i]].Key()] < b.methodIdx[c.methods[methods[j]].Key()]
+			})
+		}
+
+		data = uleb(data, 0)
+		data = uleb(data, len(fields))
+		data = uleb(data, len(direct))
+		data = uleb(data, len(virtual))
+
+		prev := 0
+		for _, idx := range fields {
+			data = uleb(data, idx-prev)
+			data = uleb(data, int(AccPublic))
+			prev = idx
+		}
+		for _, methods := range [][]int{direct, virtual} {
+			prev = 0
+			for _, mi := range methods {
+				m := c.methods[mi]
+				idx := b.methodIdx[m.Key()]
+				data = uleb(data, idx-prev)
+				data = uleb(data, int(m.accessFlags))
+				data = uleb(data, codeOffs[[2]int{ci, mi}])
+				prev = idx
+			}
+		}
+	}
+
+	// Each annotated class has an annotation_item for each annotation, an
+	// annotation_set_item listing them, and an annotations_directory_item
+	// with no annotated members.
+	annotationStart := dataOff + len(data)
+	annotationOffs := make([][]int, len(b.dex.classes))
+	annotations := 0
+	for ci, c := range b.dex.classes {
+		for _, a := range c.annotations {
+			annotationOffs[ci] = append(annotationOffs[ci], dataOff+len(data))
+			annotations++
+			data = append(data, 1) // VISIBILITY_RUNTIME
+			data = uleb(data, b.typeIdx[a])
+			data = uleb(data, 0)
+		}
+	}
+	align()
+	annotationSetStart := dataOff + len(data)
+	annotationSetOffs := make([]int, len(b.dex.classes))
+	annotationSets := 0
+	for ci, offs := range annotationOffs {
+		if len(offs) == 0 {
+			continue
+		}
+		annotationSetOffs[ci] = dataOff + len(data)
+		annotationSets++
+		data = u32(data, len(offs))
+		for _, off := range offs {
+			data = u32(data, off)
+		}
+	}
+	annotationsDirectoryStart := dataOff + len(data)
+	annotationsDirectoryOffs := make([]int, len(b.dex.classes))
+	for ci, setOff := range annotationSetOffs {
+		if setOff == 0 {
+			continue
+		}
+		annotationsDirectoryOffs[ci] = dataOff + len(data)
+		data = u32(data, setOff)
+		data = u32(data, 0) // fields_size
+		data = u32(data, 0) // annotated_methods_size
+		data = u32(data, 0) // annotated_parameters_size
+	}
+
+	align()
+	mapOff := dataOff + len(data)
+	type mapEntry struct{ itemType, size, offset int }
+	entries := []mapEntry{
+		{typeHeaderItem, 1, 0},
+		{typeStringIdItem, len(b.strings), stringIdsOff},
+		{typeTypeIdItem, len(b.types), typeIdsOff},
+		{typeProtoIdItem, len(b.protos), protoIdsOff},
+		{typeFieldIdItem, len(b.fields), fieldIdsOff},
+		{typeMethodIdItem, len(b.methods), methodIdsOff},
+		{typeClassDefItem, len(b.dex.classes), classDefsOff},
+		{typeCallSiteIdItem, len(b.dex.callSites), callSiteIdsOff},
+		{typeMethodHandleItem, len(b.handles), methodHandlesOff},
+		{typeCodeItem, len(codeOffs), codeStart},
+		{typeTypeList, typeLists, typeListStart},
+		{typeStringDataItem, len(b.strings), stringDataStart},
+		{typeEncodedArrayItem, len(b.dex.callSites), callSitesStart},
+		{typeClassDataItem, len(b.dex.classes), classDataStart},
+		{typeAnnotationItem, annotations, annotationStart},
+		{typeAnnotationSetItem, annotationSets, annotationSetStart},
+		{typeAnnotationsDirectoryItem, annotationSets, annotationsDirectoryStart},
+		{typeMapList, 1, mapOff},
+	}
+	nonEmpty := entries[:0]
+	for _, e := range entries {
+		if e.size > 0 {
+			nonEmpty = append(nonEmpty, e)
+		}
+	}
+	data = u32(data, len(nonEmpty))
+	for _, e := range nonEmpty {
+		data = u16(data, e.itemType)
+		data = u16(data, 0)
+		data = u32(data, e.size)
+		data = u32(data, e.offset)
+	}
+
+	version := b.dex.version
+	if version == 0 {
+		version = 35
+	}
+	sectionOff := func(size, off int) int {
+		if size == 0 {
+			return 0
+		}
+		return off
+	}
+
+	buf := []byte(fmt.Sprintf("dex\n%03d\x00", version))
+	buf = append(buf, make([]byte, 4+sha1.Size)...) // checksum and signature
+	buf = u32(buf, dataOff+len(data))
+	buf = u32(buf, headerSize)
+	buf = u32(buf, endianConstant)
+	buf = u32(buf, 0) // link_size
+	buf = u32(buf, 0) // link_off
+	buf = u32(buf, mapOff)
+	for _, section := range [][2]int{
+		{len(b.strings), stringIdsOff},
+		{len(b.types), typeIdsOff},
+		{len(b.protos), protoIdsOff},
+		{len(b.fields), fieldIdsOff},
+		{len(b.methods), methodIdsOff},
+		{len(b.dex.classes), classDefsOff},
+	} {
+		buf = u32(buf, section[0])
+		buf = u32(buf, sectionOff(section[0], section[1]))
+	}
+	buf = u32(buf, len(data))
+	buf = u32(buf, dataOff)
+
+	for _, off := range stringDataOffs {
+		buf = u32(buf, off)
+	}
+	for _, t := range b.types {
+		buf = u32(buf, b.stringIdx[t])
+	}
+	for i, p := range b.protos {
+		buf = u32(buf, b.stringIdx[p.shorty])
+		buf = u32(buf, b.typeIdx[p.returnType])
+		buf = u32(buf, typeListOffs[i])
+	}
+	for _, f := range b.fields {
+		buf = u16(buf, b.typeIdx[f.DeclClass])
+		buf = u16(buf, b.typeIdx[f.FieldType])
+		buf = u32(buf, b.stringIdx[f.FieldName])
+	}
+	for _, m := range b.methods {
+		buf = u16(buf, b.typeIdx[m.DeclClass])
+		buf = u16(buf, b.protoIdx[protoOf(m).key()])
+		buf = u32(buf, b.stringIdx[m.MethodName])
+	}
+	for ci, c := range b.dex.classes {
+		superClass := noIndex
+		if c.superClass != "" {
+			superClass = b.typeIdx[c.superClass]
+		}
+
+		buf = u32(buf, b.typeIdx[c.name])
+		buf = u32(buf, int(AccPublic))
+		buf = u32(buf, superClass)
+		buf = u32(buf, 0)       // interfaces_off
+		buf = u32(buf, noIndex) // source_file_idx
+		buf = u32(buf, annotationsDirectoryOffs[ci])
+		buf = u32(buf, classDataOffs[ci])
+		buf = u32(buf, 0) // static_values_off
+	}
+	for _, off := range callSiteOffs {
+		buf = u32(buf, off)
+	}
+	for _, h := range b.handles {
+		buf = u16(buf, methodHandleInvokeStatic)
+		buf = u16(buf, 0)
+		buf = u16(buf, b.methodIdx[h.Key()])
+		buf = u16(buf, 0)
+	}
+
+	buf = append(buf, data...)
+
+	signature := sha1.Sum(buf[signatureEnd:])
+	copy(buf[signatureOff:], signature[:])
+	le.PutUint32(buf[checksumOff:], adler32.Checksum(buf[signatureOff:]))
+
+	return buf
+}
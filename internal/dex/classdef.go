@@ -0,0 +1,95 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+// Access flags of classes, fields and methods.
+const (
+	AccPublic               = 0x1
+	AccPrivate              = 0x2
+	AccProtected            = 0x4
+	AccStatic               = 0x8
+	AccFinal                = 0x10
+	AccSynchronized         = 0x20
+	AccVolatile             = 0x40
+	AccBridge               = 0x40
+	AccTransient            = 0x80
+	AccVarargs              = 0x80
+	AccNative               = 0x100
+	AccInterface            = 0x200
+	AccAbstract             = 0x400
+	AccStrict               = 0x800
+	AccSynthetic            = 0x1000
+	AccAnnotation           = 0x2000
+	AccEnum                 = 0x4000
+	AccConstructor          = 0x10000
+	AccDeclaredSynchronized = 0x20000
+)
+
+// A class defined in a DEX file.
+type ClassDef struct {
+	ClassName   string
+	AccessFlags uint32
+	// The descriptor of the class's superclass. Empty for java.lang.Object,
+	// which has none.
+	SuperClass string
+	// The descriptors of the annotations on the class, e.g.
+	// "Lkotlin/Metadata;".
+	Annotations []string
+	// Static fields followed by instance fields.
+	Fields []DefinedField
+	// Direct methods followed by virtual methods.
+	Methods []DefinedMethod
+}
+
+type DefinedField struct {
+	FieldRef
+	AccessFlags uint32
+}
+
+type DefinedMethod struct {
+	MethodRef
+	AccessFlags uint32
+	// nil for abstract and native methods.
+	Code *CodeItem
+}
+
+// The header of a method's code_item, and its try blocks.
+type CodeItem struct {
+	RegistersSize int
+	InsSize       int
+	OutsSize      int
+	Tries         []TryItem
+	DebugInfoOff  int
+	// The number of 16-bit code units of bytecode.
+	InsnsSize int
+}
+
+// A range of instructions covered by exception handlers.
+type TryItem struct {
+	// The first code unit covered, and the number of code units covered.
+	StartAddr int
+	InsnCount int
+	// The offset in bytes of the handlers, from the start of the method's
+	// encoded_catch_handler_list.
+	HandlerOff int
+}
+
+// Returns the size of the method's bytecode, in bytes.
+func (c CodeItem) InsnsBytes() int {
+	return c.InsnsSize * 2
+}
@@ -0,0 +1,159 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import "fmt"
+
+// The methods invoked and fields accessed by the code of a method defined in
+// the DEX file. A target is listed once per instruction which references it.
+//
+// const-method-handle references the field or method of its method handle.
+// invoke-custom references the bootstrap method of its call site and every
+// method handle passed to it, such as the body of a lambda. The target of
+// invoke-polymorphic is only known at run time, so it only references the
+// MethodHandle or VarHandle method which it invokes.
+type CodeRefs struct {
+	Caller     MethodRef
+	MethodRefs []MethodRef
+	FieldRefs  []FieldRef
+}
+
+// Decodes the code of every method defined in the DEX file, and returns the
+// methods and fields each one references. Methods which share a code_item
+// share the slices of references too.
+func (d *Data) GetCodeRefs() ([]CodeRefs, error) {
+	codeRefs := make([]CodeRefs, 0)
+	decoded := make(map[*codeItem]CodeRefs)
+
+	for _, classDef := range d.classDefs {
+		for _, methods := range [][]encodedMethod{classDef.directMethods, classDef.virtualMethods} {
+			for _, method := range methods {
+				if method.code == nil {
+					continue
+				}
+
+				refs, ok := decoded[method.code]
+				if ok {
+					refs.Caller = d.methodRefFromIndex(method.methodIdx)
+				} else {
+					var err error
+					if refs, err = d.codeRefs(method); err != nil {
+						return nil, err
+					}
+					decoded[method.code] = refs
+				}
+				codeRefs = append(codeRefs, refs)
+			}
+		}
+	}
+
+	return codeRefs, nil
+}
+
+func (d *Data) codeRefs(method encodedMethod) (CodeRefs, error) {
+	refs := CodeRefs{Caller: d.methodRefFromIndex(method.methodIdx)}
+
+	insnsOff := method.code.insnsOff
+	insns, err := d.readCodeUnits(insnsOff, method.code.insnsSize)
+	if err != nil {
+		return refs, withSection("code_item", err)
+	}
+
+	var decodeErr error
+	err = DecodeInstructions(insns, func(insn Instruction) {
+		if decodeErr != nil {
+			return
+		}
+
+		switch insn.IndexKind {
+		case IndexMethod:
+			if insn.Index >= len(d.methodIds) {
+				decodeErr = instructionError(refs.Caller, insnsOff+insn.Offset*2, fmt.Errorf("method_idx %d is out of range [0, %d)", insn.Index, len(d.methodIds)))
+				return
+			}
+			refs.MethodRefs = append(refs.MethodRefs, d.methodRefFromIndex(insn.Index))
+		case IndexField:
+			if insn.Index >= len(d.fieldIds) {
+				decodeErr = instructionError(refs.Caller, insnsOff+insn.Offset*2, fmt.Errorf("field_idx %d is out of range [0, %d)", insn.Index, len(d.fieldIds)))
+				return
+			}
+			refs.FieldRefs = append(refs.FieldRefs, d.fieldRefFromIndex(insn.Index))
+		case IndexCallSite:
+			if insn.Index >= len(d.callSites) {
+				decodeErr = instructionError(refs.Caller, insnsOff+insn.Offset*2, fmt.Errorf("call_site_idx %d is out of range [0, %d)", insn.Index, len(d.callSites)))
+				return
+			}
+			for _, h := range d.callSites[insn.Index].methodHandles {
+				d.addMethodHandleRef(&refs, h)
+			}
+		case IndexMethodHandle:
+			if insn.Index >= len(d.methodHandles) {
+				decodeErr = instructionError(refs.Caller, insnsOff+insn.Offset*2, fmt.Errorf("method_handle_idx %d is out of range [0, %d)", insn.Index, len(d.methodHandles)))
+				return
+			}
+			d.addMethodHandleRef(&refs, insn.Index)
+		}
+	})
+	if err != nil {
+		return refs, instructionError(refs.Caller, insnsOff, err)
+	}
+	if decodeErr != nil {
+		return refs, decodeErr
+	}
+
+	return refs, nil
+}
+
+// Adds the field or method which the method handle at the given index refers
+// to.
+func (d *Data) addMethodHandleRef(refs *CodeRefs, idx int) {
+	h := d.methodHandles[idx]
+	if h.isFieldAccess() {
+		refs.FieldRefs = append(refs.FieldRefs, d.fieldRefFromIndex(h.fieldOrMethodId))
+	} else {
+		refs.MethodRefs = append(refs.MethodRefs, d.methodRefFromIndex(h.fieldOrMethodId))
+	}
+}
+
+func instructionError(caller MethodRef, offset int, err error) error {
+	return &FormatError{
+		Section: "code_item",
+		Offset:  offset,
+		Index:   -1,
+		Err:     fmt.Errorf("%s.%s: %v", caller.DeclClass, caller.MethodName, err),
+	}
+}
+
+// Reads count 16-bit code units starting at the given file offset.
+func (d *Data) readCodeUnits(offset, count int) ([]uint16, error) {
+	if err := d.seek(offset); err != nil {
+		return nil, err
+	}
+
+	buf, err := d.readBytes(count * 2)
+	if err != nil {
+		return nil, err
+	}
+
+	units := make([]uint16, count)
+	for i := range units {
+		units[i] = d.order.Uint16(buf[i*2:])
+	}
+
+	return units, nil
+}
@@ -0,0 +1,77 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func methodKeys(refs []MethodRef) []MethodRefKey {
+	keys := make([]MethodRefKey, len(refs))
+	for i, ref := range refs {
+		keys[i] = ref.Key()
+	}
+	return keys
+}
+
+func fieldKeys(refs []FieldRef) []FieldRefKey {
+	keys := make([]FieldRefKey, len(refs))
+	for i, ref := range refs {
+		keys[i] = ref.Key()
+	}
+	return keys
+}
+
+// Checks that invoke-custom and const-method-handle resolve to the methods
+// their call site and method handle refer to.
+func TestCodeRefsThroughMethodHandles(t *testing.T) {
+	d, err := Parse(readFixture(t, "app39.dex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	codeRefs, err := d.GetCodeRefs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixture := appDex(39)
+	onCreate := fixture.classes[0].methods[1]
+	lambda := fixture.classes[0].methods[2]
+
+	var got *CodeRefs
+	for i := range codeRefs {
+		if codeRefs[i].Caller.Key() == onCreate.Key() {
+			got = &codeRefs[i]
+		}
+	}
+	if got == nil {
+		t.Fatalf("GetCodeRefs() has no entry for %s", onCreate.JavaSignature())
+	}
+
+	// The direct calls, then the bootstrap method and body of the lambda, then
+	// the method handle.
+	want := append(append([]MethodRef{}, onCreate.calls...), lambdaMetafactory, lambda.MethodRef, onCreate.handles[0])
+	if !reflect.DeepEqual(methodKeys(got.MethodRefs), methodKeys(want)) {
+		t.Errorf("MethodRefs = %v, want %v", methodKeys(got.MethodRefs), methodKeys(want))
+	}
+	if !reflect.DeepEqual(fieldKeys(got.FieldRefs), fieldKeys(onCreate.gets)) {
+		t.Errorf("FieldRefs = %v, want %v", fieldKeys(got.FieldRefs), fieldKeys(onCreate.gets))
+	}
+}
@@ -22,7 +22,9 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"os"
+	"io"
+
+	"github.com/rsookram/dex-method-counts/mutf8"
 )
 
 const (
@@ -30,9 +32,28 @@ const (
 	reverseEndianConstant = 0x78563412
 )
 
+// The value of an index which refers to nothing, e.g. the superclass_idx of
+// java.lang.Object.
+const noIndex = 0xffffffff
+
+// DEX format versions understood by the parser. Version 035 is the original
+// format, 037 (Android 7.0) adds default interface methods, 038 (Android 8.0)
+// adds call sites and method handles, 039 (Android 9) adds the
+// const-method-handle and const-method-type instructions, and 040 (Android
+// 10+) relaxes restrictions on simple names. 036 was never shipped, but is accepted for
+// compatibility with older tools which emitted it.
+const (
+	minVersion = 35
+	maxVersion = 40
+)
+
 // Data extracted from a DEX file.
 type Data struct {
-	dexFile    os.File
+	// The contents of the file, and the position of the next read within it.
+	buf []byte
+	pos int
+
+	version    int
 	headerItem headerItem
 	strings    []string
 	typeIds    []typeIdItem
@@ -41,18 +62,20 @@ type Data struct {
 	methodIds  []methodIdItem
 	classDefs  []classDefItem
 
-	tmpBuf       []byte
-	tmpSingleBuf []byte
-	tmpShortBuf  []byte
-	isBigEndian  bool
+	mapList       []mapItem
+	callSites     []callSiteItem
+	methodHandles []methodHandleItem
+
+	// The byte order of everything after the magic, as given by the endian tag.
+	order binary.ByteOrder
 }
 
-func New(f os.File) (*Data, error) {
+// Parses a DEX file which has already been read into memory. The returned Data
+// refers to buf, so it must not be modified afterwards.
+func Parse(buf []byte) (*Data, error) {
 	data := Data{
-		dexFile:      f,
-		tmpBuf:       make([]byte, 4),
-		tmpSingleBuf: make([]byte, 1),
-		tmpShortBuf:  make([]byte, 2),
+		buf:   buf,
+		order: binary.LittleEndian,
 	}
 
 	err := data.load()
@@ -65,63 +88,76 @@ func New(f os.File) (*Data, error) {
 
 // Loads the contents of the DEX file into our data structures.
 func (d *Data) load() error {
-	err := d.parseHeaderItem()
-	if err != nil {
-		return err
-	}
-
-	if err = d.loadStrings(); err != nil {
-		return err
-	}
-	if err = d.loadTypeIds(); err != nil {
-		return err
-	}
-	if err = d.loadProtoIds(); err != nil {
-		return err
-	}
-	if err = d.loadFieldIds(); err != nil {
-		return err
-	}
-	if err = d.loadMethodIds(); err != nil {
-		return err
-	}
-	if err = d.loadClassDefs(); err != nil {
-		return err
+	steps := []struct {
+		section string
+		load    func() error
+	}{
+		{"header_item", d.parseHeaderItem},
+		{"string_ids", d.loadStrings},
+		{"type_ids", d.loadTypeIds},
+		{"proto_ids", d.loadProtoIds},
+		{"field_ids", d.loadFieldIds},
+		{"method_ids", d.loadMethodIds},
+		{"class_defs", d.loadClassDefs},
+		{"", d.checkIndices},
+		{"class_data_item", d.loadClassData},
+		{"code_item", d.loadCodeItems},
+		{"annotations_directory_item", d.loadClassAnnotations},
+		{"map_list", d.loadMapList},
+		{"method_handles", d.loadMethodHandles},
+		{"call_site_ids", d.loadCallSiteIds},
+	}
+
+	for _, step := range steps {
+		if err := step.load(); err != nil {
+			return withSection(step.section, err)
+		}
 	}
 
 	d.markInternalClasses()
+	d.parseTypes()
 
 	return nil
 }
 
+// Attributes an error to the given section, unless it's a FormatError which
+// already names one.
+func withSection(section string, err error) error {
+	if fe, ok := err.(*FormatError); ok {
+		if fe.Section == "" {
+			fe.Section = section
+		}
+		return fe
+	}
+
+	return &FormatError{Section: section, Offset: -1, Index: -1, Err: err}
+}
+
 // Parses the interesting bits out of the header.
 func (d *Data) parseHeaderItem() error {
 	d.headerItem = headerItem{}
 
-	_, err := d.dexFile.Seek(0, os.SEEK_SET)
+	magic, err := d.readBytes(8)
 	if err != nil {
 		return err
 	}
 
-	magic := make([]byte, 8)
-	err = readFully(d.dexFile, magic)
-	if err != nil {
-		return err
+	version, ok := parseMagic(magic)
+	if !ok {
+		return &FormatError{Offset: 0, Index: -1, Err: errors.New("wrong magic number -- are you sure this is a DEX file?")}
 	}
-
-	if !verifyMagic(magic) {
-		fmt.Fprintln(os.Stderr, "Magic number is wrong -- are you sure this is a DEX file?")
-		return errors.New("wrong magic number")
+	if version < minVersion || version > maxVersion {
+		return &FormatError{Offset: 4, Index: -1, Err: fmt.Errorf("unsupported dex version %03d", version)}
 	}
+	d.version = version
 
 	// Read the endian tag, so we properly swap things as we read them from here
 	// on.
-	_, err = d.dexFile.Seek(8+4+20+4+4, os.SEEK_SET)
-	if err != nil {
+	if err = d.seek(8 + 4 + 20 + 4 + 4); err != nil {
 		return err
 	}
 
-	endianTag, err := d.readInt()
+	endianTag, err := d.readUint()
 	if err != nil {
 		return err
 	}
@@ -131,130 +167,128 @@ func (d *Data) parseHeaderItem() error {
 		// standard dex files are little endian
 	} else if endianTag == reverseEndianConstant {
 		// file is big-endian, reverse future reads
-		d.isBigEndian = true
+		d.order = binary.BigEndian
 	} else {
-		endianHex := fmt.Sprintf("%x", endianTag)
-		fmt.Fprintln(os.Stderr, "Endian constant has unexpected value "+endianHex)
-		return errors.New("unexpected endian constant " + endianHex)
+		return &FormatError{Offset: 8 + 4 + 20 + 4 + 4, Index: -1, Err: fmt.Errorf("unexpected endian constant %x", endianTag)}
 	}
 
 	// magic, checksum, signature
-	_, err = d.dexFile.Seek(8+4+20, os.SEEK_SET)
-	if err != nil {
+	if err = d.seek(8 + 4 + 20); err != nil {
 		return err
 	}
 
-	fileSize, err := d.readInt()
+	fileSize, err := d.readUint()
 	if err != nil {
 		return err
 	}
-	d.headerItem.fileSize = fileSize
+	d.headerItem.fileSize = int(fileSize)
 
-	headerSize, err := d.readInt()
+	headerSize, err := d.readUint()
 	if err != nil {
 		return err
 	}
-	d.headerItem.headerSize = headerSize
+	d.headerItem.headerSize = int(headerSize)
 
 	// endianTag
-	if _, err = d.readInt(); err != nil {
+	if _, err = d.readUint(); err != nil {
 		return err
 	}
 
 	// linkSize
-	if _, err = d.readInt(); err != nil {
+	if _, err = d.readUint(); err != nil {
 		return err
 	}
 
 	// linkOff
-	if _, err = d.readInt(); err != nil {
+	if _, err = d.readUint(); err != nil {
 		return err
 	}
 
-	// mapOff
-	if _, err = d.readInt(); err != nil {
+	mapOff, err := d.readUint()
+	if err != nil {
 		return err
 	}
+	d.headerItem.mapOff = int(mapOff)
 
-	stringIdsSize, err := d.readInt()
+	stringIdsSize, err := d.readUint()
 	if err != nil {
 		return err
 	}
-	d.headerItem.stringIdsSize = stringIdsSize
+	d.headerItem.stringIdsSize = int(stringIdsSize)
 
-	stringIdsOff, err := d.readInt()
+	stringIdsOff, err := d.readUint()
 	if err != nil {
 		return err
 	}
-	d.headerItem.stringIdsOff = stringIdsOff
+	d.headerItem.stringIdsOff = int(stringIdsOff)
 
-	typeIdsSize, err := d.readInt()
+	typeIdsSize, err := d.readUint()
 	if err != nil {
 		return err
 	}
-	d.headerItem.typeIdsSize = typeIdsSize
+	d.headerItem.typeIdsSize = int(typeIdsSize)
 
-	typeIdsOff, err := d.readInt()
+	typeIdsOff, err := d.readUint()
 	if err != nil {
 		return err
 	}
-	d.headerItem.typeIdsOff = typeIdsOff
+	d.headerItem.typeIdsOff = int(typeIdsOff)
 
-	protoIdsSize, err := d.readInt()
+	protoIdsSize, err := d.readUint()
 	if err != nil {
 		return err
 	}
-	d.headerItem.protoIdsSize = protoIdsSize
+	d.headerItem.protoIdsSize = int(protoIdsSize)
 
-	protoIdsOff, err := d.readInt()
+	protoIdsOff, err := d.readUint()
 	if err != nil {
 		return err
 	}
-	d.headerItem.protoIdsOff = protoIdsOff
+	d.headerItem.protoIdsOff = int(protoIdsOff)
 
-	fieldIdsSize, err := d.readInt()
+	fieldIdsSize, err := d.readUint()
 	if err != nil {
 		return err
 	}
-	d.headerItem.fieldIdsSize = fieldIdsSize
+	d.headerItem.fieldIdsSize = int(fieldIdsSize)
 
-	fieldIdsOff, err := d.readInt()
+	fieldIdsOff, err := d.readUint()
 	if err != nil {
 		return err
 	}
-	d.headerItem.fieldIdsOff = fieldIdsOff
+	d.headerItem.fieldIdsOff = int(fieldIdsOff)
 
-	methodIdsSize, err := d.readInt()
+	methodIdsSize, err := d.readUint()
 	if err != nil {
 		return err
 	}
-	d.headerItem.methodIdsSize = methodIdsSize
+	d.headerItem.methodIdsSize = int(methodIdsSize)
 
-	methodIdsOff, err := d.readInt()
+	methodIdsOff, err := d.readUint()
 	if err != nil {
 		return err
 	}
-	d.headerItem.methodIdsOff = methodIdsOff
+	d.headerItem.methodIdsOff = int(methodIdsOff)
 
-	classDefsSize, err := d.readInt()
+	classDefsSize, err := d.readUint()
 	if err != nil {
 		return err
 	}
-	d.headerItem.classDefsSize = classDefsSize
+	d.headerItem.classDefsSize = int(classDefsSize)
 
-	classDefsOff, err := d.readInt()
+	classDefsOff, err := d.readUint()
 	if err != nil {
 		return err
 	}
-	d.headerItem.classDefsOff = classDefsOff
+	d.headerItem.classDefsOff = int(classDefsOff)
 
 	// dataSize
-	if _, err = d.readInt(); err != nil {
+	if _, err = d.readUint(); err != nil {
 		return err
 	}
 
 	// dataOff
-	if _, err = d.readInt(); err != nil {
+	if _, err = d.readUint(); err != nil {
 		return err
 	}
 
@@ -264,41 +298,36 @@ func (d *Data) parseHeaderItem() error {
 // Loads the string table out of the DEX.
 //
 // First we read all of the string_id_items, then we read all of the
-// string_data_item. Doing it this way should allow us to avoid seeking around
-// in the file.
+// string_data_items they point to.
 func (d *Data) loadStrings() error {
 	count := d.headerItem.stringIdsSize
+	if err := d.checkSection(d.headerItem.stringIdsOff, count, 4); err != nil {
+		return err
+	}
 	stringOffsets := make([]int, count)
 
-	_, err := d.dexFile.Seek(int64(d.headerItem.stringIdsOff), os.SEEK_SET)
-	if err != nil {
+	if err := d.seek(d.headerItem.stringIdsOff); err != nil {
 		return err
 	}
 
 	for i := 0; i < count; i++ {
-		offset, err := d.readInt()
+		offset, err := d.readUint()
 		if err != nil {
 			return err
 		}
 
-		stringOffsets[i] = offset
+		stringOffsets[i] = int(offset)
 	}
 
 	d.strings = make([]string, count)
 
-	_, err = d.dexFile.Seek(int64(stringOffsets[0]), os.SEEK_SET)
-	if err != nil {
-		return err
-	}
-
 	for i, offset := range stringOffsets {
-		// should be a no-op
-		_, err := d.dexFile.Seek(int64(offset), os.SEEK_SET)
-		if err != nil {
+		if err := d.seek(offset); err != nil {
 			return err
 		}
 
-		d.strings[i], err = readString(d.dexFile, d.tmpSingleBuf)
+		var err error
+		d.strings[i], err = d.readString()
 		if err != nil {
 			return err
 		}
@@ -310,16 +339,19 @@ func (d *Data) loadStrings() error {
 // Loads the type ID list.
 func (d *Data) loadTypeIds() error {
 	count := d.headerItem.typeIdsSize
+	if err := d.checkSection(d.headerItem.typeIdsOff, count, 4); err != nil {
+		return err
+	}
 	d.typeIds = make([]typeIdItem, count)
 
-	if _, err := d.dexFile.Seek(int64(d.headerItem.typeIdsOff), os.SEEK_SET); err != nil {
+	if err := d.seek(d.headerItem.typeIdsOff); err != nil {
 		return err
 	}
 
 	for i := 0; i < count; i++ {
 		d.typeIds[i] = typeIdItem{}
 
-		descriptorIdx, err := d.readInt()
+		descriptorIdx, err := d.readUint()
 		if err != nil {
 			return err
 		}
@@ -333,9 +365,12 @@ func (d *Data) loadTypeIds() error {
 // Loads the proto ID list.
 func (d *Data) loadProtoIds() error {
 	count := d.headerItem.protoIdsSize
+	if err := d.checkSection(d.headerItem.protoIdsOff, count, 12); err != nil {
+		return err
+	}
 	d.protoIds = make([]protoIdItem, count)
 
-	if _, err := d.dexFile.Seek(int64(d.headerItem.protoIdsOff), os.SEEK_SET); err != nil {
+	if err := d.seek(d.headerItem.protoIdsOff); err != nil {
 		return err
 	}
 
@@ -343,50 +378,54 @@ func (d *Data) loadProtoIds() error {
 	for i := 0; i < count; i++ {
 		d.protoIds[i] = protoIdItem{}
 
-		shortyIdx, err := d.readInt()
+		shortyIdx, err := d.readUint()
 		if err != nil {
 			return err
 		}
 
 		d.protoIds[i].shortyIdx = shortyIdx
 
-		returnTypeIdx, err := d.readInt()
+		returnTypeIdx, err := d.readUint()
 		if err != nil {
 			return err
 		}
 
 		d.protoIds[i].returnTypeIdx = returnTypeIdx
 
-		parametersOff, err := d.readInt()
+		parametersOff, err := d.readUint()
 		if err != nil {
 			return err
 		}
 
-		d.protoIds[i].parametersOff = parametersOff
+		d.protoIds[i].parametersOff = int(parametersOff)
 	}
 
 	// Go back through and read the type lists.
-	for _, protoId := range d.protoIds {
+	for i := range d.protoIds {
+		protoId := &d.protoIds[i]
 		offset := protoId.parametersOff
 
 		if offset == 0 {
-			protoId.types = make([]int16, 0)
+			protoId.types = make([]uint16, 0)
 			continue
 		}
 
-		if _, err := d.dexFile.Seek(int64(offset), os.SEEK_SET); err != nil {
+		if err := d.seek(offset); err != nil {
 			return err
 		}
 
-		size, err := d.readInt() // #of entries in list
+		size, err := d.readUint() // #of entries in list
 		if err != nil {
 			return err
 		}
+		if err := d.checkSection(offset+4, int(size), 2); err != nil {
+			return err
+		}
 
-		protoId.types = make([]int16, size)
+		protoId.types = make([]uint16, size)
 
-		for j := 0; j < size; j++ {
-			t, err := d.readShort()
+		for j := range protoId.types {
+			t, err := d.readUshort()
 			if err != nil {
 				return err
 			}
@@ -401,30 +440,33 @@ func (d *Data) loadProtoIds() error {
 // Loads the field ID list.
 func (d *Data) loadFieldIds() error {
 	count := d.headerItem.fieldIdsSize
+	if err := d.checkSection(d.headerItem.fieldIdsOff, count, 8); err != nil {
+		return err
+	}
 	d.fieldIds = make([]fieldIdItem, count)
 
-	if _, err := d.dexFile.Seek(int64(d.headerItem.fieldIdsOff), os.SEEK_SET); err != nil {
+	if err := d.seek(d.headerItem.fieldIdsOff); err != nil {
 		return err
 	}
 
 	for i := 0; i < count; i++ {
 		d.fieldIds[i] = fieldIdItem{}
 
-		classIdx, err := d.readShort()
+		classIdx, err := d.readUshort()
 		if err != nil {
 			return err
 		}
 
 		d.fieldIds[i].classIdx = classIdx
 
-		typeIdx, err := d.readShort()
+		typeIdx, err := d.readUshort()
 		if err != nil {
 			return err
 		}
 
 		d.fieldIds[i].typeIdx = typeIdx
 
-		nameIdx, err := d.readInt()
+		nameIdx, err := d.readUint()
 		if err != nil {
 			return err
 		}
@@ -438,30 +480,33 @@ func (d *Data) loadFieldIds() error {
 // Loads the method ID list.
 func (d *Data) loadMethodIds() error {
 	count := d.headerItem.methodIdsSize
+	if err := d.checkSection(d.headerItem.methodIdsOff, count, 8); err != nil {
+		return err
+	}
 	d.methodIds = make([]methodIdItem, count)
 
-	if _, err := d.dexFile.Seek(int64(d.headerItem.methodIdsOff), os.SEEK_SET); err != nil {
+	if err := d.seek(d.headerItem.methodIdsOff); err != nil {
 		return err
 	}
 
 	for i := 0; i < count; i++ {
 		d.methodIds[i] = methodIdItem{}
 
-		classIdx, err := d.readShort()
+		classIdx, err := d.readUshort()
 		if err != nil {
 			return err
 		}
 
 		d.methodIds[i].classIdx = classIdx
 
-		protoIdx, err := d.readShort()
+		protoIdx, err := d.readUshort()
 		if err != nil {
 			return err
 		}
 
 		d.methodIds[i].protoIdx = protoIdx
 
-		nameIdx, err := d.readInt()
+		nameIdx, err := d.readUint()
 		if err != nil {
 			return err
 		}
@@ -475,48 +520,561 @@ func (d *Data) loadMethodIds() error {
 // Loads the class defs list
 func (d *Data) loadClassDefs() error {
 	count := d.headerItem.classDefsSize
+	if err := d.checkSection(d.headerItem.classDefsOff, count, 32); err != nil {
+		return err
+	}
 	d.classDefs = make([]classDefItem, count)
 
-	if _, err := d.dexFile.Seek(int64(d.headerItem.classDefsOff), os.SEEK_SET); err != nil {
+	if err := d.seek(d.headerItem.classDefsOff); err != nil {
 		return err
 	}
 
 	for i := 0; i < count; i++ {
 		d.classDefs[i] = classDefItem{}
 
-		classIdx, err := d.readInt()
+		classIdx, err := d.readUint()
 		if err != nil {
 			return err
 		}
 
 		d.classDefs[i].classIdx = classIdx
 
-		// access_flags
-		if _, err = d.readInt(); err != nil {
+		accessFlags, err := d.readUint()
+		if err != nil {
 			return err
 		}
-		// superclass_idx
-		if _, err = d.readInt(); err != nil {
+		d.classDefs[i].accessFlags = accessFlags
+
+		superclassIdx, err := d.readUint()
+		if err != nil {
 			return err
 		}
+		d.classDefs[i].superclassIdx = superclassIdx
+
 		// interfaces_off
-		if _, err = d.readInt(); err != nil {
+		if _, err = d.readUint(); err != nil {
 			return err
 		}
 		// source_file_idx
-		if _, err = d.readInt(); err != nil {
+		if _, err = d.readUint(); err != nil {
 			return err
 		}
-		// annotations_off
-		if _, err = d.readInt(); err != nil {
+		annotationsOff, err := d.readUint()
+		if err != nil {
 			return err
 		}
-		// class_data_off
-		if _, err = d.readInt(); err != nil {
+		d.classDefs[i].annotationsOff = int(annotationsOff)
+
+		classDataOff, err := d.readUint()
+		if err != nil {
 			return err
 		}
+		d.classDefs[i].classDataOff = int(classDataOff)
+
 		// static_values_off
-		if _, err = d.readInt(); err != nil {
+		if _, err = d.readUint(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Loads the class_data_item of each class def, which lists the fields and
+// methods that the class defines.
+func (d *Data) loadClassData() error {
+	// The number of members read so far. Class defs can share a
+	// class_data_item, so the total is bounded too, or a file could have every
+	// class def decode the same large one.
+	members := uint64(0)
+
+	for i := range d.classDefs {
+		classDef := &d.classDefs[i]
+		if classDef.classDataOff == 0 {
+			// e.g. a marker interface
+			continue
+		}
+
+		if err := d.seek(classDef.classDataOff); err != nil {
+			return err
+		}
+
+		var sizes [4]uint32
+		for j := range sizes {
+			size, err := d.readUnsignedLeb128()
+			if err != nil {
+				return err
+			}
+			sizes[j] = size
+		}
+
+		// Each encoded_field and encoded_method takes at least two bytes, which
+		// bounds the counts before anything is allocated.
+		total := uint64(sizes[0]) + uint64(sizes[1]) + uint64(sizes[2]) + uint64(sizes[3])
+		if total*2 > uint64(len(d.buf)-d.pos) {
+			return &FormatError{Offset: classDef.classDataOff, Index: i, Err: fmt.Errorf("%d members don't fit in the file", total)}
+		}
+		members += total
+		if members*2 > uint64(len(d.buf)) {
+			return &FormatError{Offset: classDef.classDataOff, Index: i, Err: fmt.Errorf("%d members in the class_data_items so far don't fit in the file", members)}
+		}
+
+		var err error
+		if classDef.staticFields, err = d.readEncodedFields(sizes[0]); err != nil {
+			return err
+		}
+		if classDef.instanceFields, err = d.readEncodedFields(sizes[1]); err != nil {
+			return err
+		}
+		if classDef.directMethods, err = d.readEncodedMethods(sizes[2]); err != nil {
+			return err
+		}
+		if classDef.virtualMethods, err = d.readEncodedMethods(sizes[3]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Loads the types of the annotations on each class, from the annotation set
+// which its annotations_directory_item gives for the class itself. The
+// annotations on members and their elements aren't read.
+func (d *Data) loadClassAnnotations() error {
+	// Class defs can share an annotation set, so each one is only read once,
+	// and the total read is bounded as in loadClassData.
+	sets := make(map[int][]uint32)
+	entries := 0
+
+	for i := range d.classDefs {
+		classDef := &d.classDefs[i]
+		if classDef.annotationsOff == 0 {
+			continue
+		}
+
+		if err := d.seek(classDef.annotationsOff); err != nil {
+			return err
+		}
+		setOff, err := d.readUint()
+		if err != nil {
+			return err
+		}
+		if setOff == 0 {
+			// Only members are annotated.
+			continue
+		}
+
+		if types, ok := sets[int(setOff)]; ok {
+			classDef.annotations = types
+			continue
+		}
+
+		types, err := d.readAnnotationSet(int(setOff))
+		if err != nil {
+			return err
+		}
+		entries += len(types)
+		if entries*4 > len(d.buf) {
+			return &FormatError{Section: "annotation_set_item", Offset: int(setOff), Index: i, Err: fmt.Errorf("%d annotations in the annotation_set_items so far don't fit in the file", entries)}
+		}
+
+		sets[int(setOff)] = types
+		classDef.annotations = types
+	}
+
+	return nil
+}
+
+// Reads the annotation_set_item at the given offset, and returns the type of
+// each annotation in it.
+func (d *Data) readAnnotationSet(offset int) ([]uint32, error) {
+	if err := d.seek(offset); err != nil {
+		return nil, withSection("annotation_set_item", err)
+	}
+	size, err := d.readUint()
+	if err != nil {
+		return nil, withSection("annotation_set_item", err)
+	}
+	if err := d.checkSection(d.pos, int(size), 4); err != nil {
+		return nil, withSection("annotation_set_item", err)
+	}
+	offsets, err := d.readBytes(int(size) * 4)
+	if err != nil {
+		return nil, withSection("annotation_set_item", err)
+	}
+
+	types := make([]uint32, size)
+	for i := range types {
+		annotationOff := int(d.order.Uint32(offsets[i*4:]))
+
+		// An annotation_item is a visibility byte followed by an
+		// encoded_annotation, which starts with the type.
+		if err := d.seek(annotationOff + 1); err != nil {
+			return nil, withSection("annotation_item", err)
+		}
+		typeIdx, err := d.readUnsignedLeb128()
+		if err != nil {
+			return nil, withSection("annotation_item", err)
+		}
+		if err := checkIndex("annotation_item", i, annotationOff, "type_idx", int(typeIdx), len(d.typeIds)); err != nil {
+			return nil, err
+		}
+		types[i] = typeIdx
+	}
+
+	return types, nil
+}
+
+// Reads a list of encoded_fields. The first field_idx_diff is the index into
+// field_ids, and each subsequent one is the difference from the previous
+// index.
+func (d *Data) readEncodedFields(count uint32) ([]encodedField, error) {
+	fields := make([]encodedField, count)
+
+	fieldIdx := uint32(0)
+	for i := range fields {
+		diff, err := d.readUnsignedLeb128()
+		if err != nil {
+			return nil, err
+		}
+		fieldIdx += diff
+
+		if int(fieldIdx) >= len(d.fieldIds) {
+			return nil, &FormatError{Offset: d.pos, Index: -1, Err: fmt.Errorf("field_idx %d is out of range [0, %d)", fieldIdx, len(d.fieldIds))}
+		}
+
+		accessFlags, err := d.readUnsignedLeb128()
+		if err != nil {
+			return nil, err
+		}
+
+		fields[i] = encodedField{fieldIdx: int(fieldIdx), accessFlags: accessFlags}
+	}
+
+	return fields, nil
+}
+
+// Reads a list of encoded_methods, with indices encoded the same way as for
+// encoded_fields.
+func (d *Data) readEncodedMethods(count uint32) ([]encodedMethod, error) {
+	methods := make([]encodedMethod, count)
+
+	methodIdx := uint32(0)
+	for i := range methods {
+		diff, err := d.readUnsignedLeb128()
+		if err != nil {
+			return nil, err
+		}
+		methodIdx += diff
+
+		if int(methodIdx) >= len(d.methodIds) {
+			return nil, &FormatError{Offset: d.pos, Index: -1, Err: fmt.Errorf("method_idx %d is out of range [0, %d)", methodIdx, len(d.methodIds))}
+		}
+
+		accessFlags, err := d.readUnsignedLeb128()
+		if err != nil {
+			return nil, err
+		}
+
+		codeOff, err := d.readUnsignedLeb128()
+		if err != nil {
+			return nil, err
+		}
+
+		methods[i] = encodedMethod{methodIdx: int(methodIdx), accessFlags: accessFlags, codeOff: int(codeOff)}
+	}
+
+	return methods, nil
+}
+
+// Loads the header of the code_item of each method which has code. The
+// instructions themselves aren't read. Methods can share a code_item, which is
+// only read once.
+func (d *Data) loadCodeItems() error {
+	codeItems := make(map[int]*codeItem)
+
+	for i := range d.classDefs {
+		classDef := &d.classDefs[i]
+
+		for _, methods := range [][]encodedMethod{classDef.directMethods, classDef.virtualMethods} {
+			for j := range methods {
+				method := &methods[j]
+				if method.codeOff == 0 {
+					continue
+				}
+
+				code, ok := codeItems[method.codeOff]
+				if !ok {
+					var err error
+					if code, err = d.readCodeItem(method.codeOff); err != nil {
+						return err
+					}
+					codeItems[method.codeOff] = code
+				}
+				method.code = code
+			}
+		}
+	}
+
+	return nil
+}
+
+// Reads the fixed-size header of the code_item at the given offset.
+func (d *Data) readCodeItem(offset int) (*codeItem, error) {
+	if err := d.seek(offset); err != nil {
+		return nil, err
+	}
+
+	var shorts [4]int
+	for i := range shorts {
+		s, err := d.readUshort()
+		if err != nil {
+			return nil, err
+		}
+		shorts[i] = int(s)
+	}
+
+	debugInfoOff, err := d.readUint()
+	if err != nil {
+		return nil, err
+	}
+
+	insnsSize, err := d.readUint()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.checkSection(offset+codeItemHeaderSize, int(insnsSize), 2); err != nil {
+		return nil, err
+	}
+
+	tries, err := d.readTryItems(offset+codeItemHeaderSize, int(insnsSize), shorts[3])
+	if err != nil {
+		return nil, err
+	}
+
+	return &codeItem{
+		registersSize: shorts[0],
+		insSize:       shorts[1],
+		outsSize:      shorts[2],
+		tries:         tries,
+		debugInfoOff:  int(debugInfoOff),
+		insnsSize:     int(insnsSize),
+		insnsOff:      offset + codeItemHeaderSize,
+	}, nil
+}
+
+// Reads the try_items which follow a method's instructions. They're 4-byte
+// aligned, so there are two bytes of padding after an odd number of code
+// units.
+func (d *Data) readTryItems(insnsOff, insnsSize, count int) ([]TryItem, error) {
+	if count == 0 {
+		return nil, nil
+	}
+
+	offset := insnsOff + insnsSize*2
+	if insnsSize%2 != 0 {
+		offset += 2
+	}
+	if err := d.checkSection(offset, count, 8); err != nil {
+		return nil, err
+	}
+	if err := d.seek(offset); err != nil {
+		return nil, err
+	}
+
+	tries := make([]TryItem, count)
+	for i := range tries {
+		startAddr, err := d.readUint()
+		if err != nil {
+			return nil, err
+		}
+
+		insnCount, err := d.readUshort()
+		if err != nil {
+			return nil, err
+		}
+
+		handlerOff, err := d.readUshort()
+		if err != nil {
+			return nil, err
+		}
+
+		if int64(startAddr)+int64(insnCount) > int64(insnsSize) {
+			return nil, &FormatError{Section: "try_item", Offset: offset + i*8, Index: i, Err: fmt.Errorf("covers code units [%d, %d) of a method with %d", startAddr, int64(startAddr)+int64(insnCount), insnsSize)}
+		}
+
+		tries[i] = TryItem{
+			StartAddr:  int(startAddr),
+			InsnCount:  int(insnCount),
+			HandlerOff: int(handlerOff),
+		}
+	}
+
+	return tries, nil
+}
+
+// Loads the map_list, which describes every section in the file. Only the
+// sections which aren't referenced from the header are of interest here.
+func (d *Data) loadMapList() error {
+	if d.headerItem.mapOff == 0 {
+		return nil
+	}
+
+	if err := d.seek(d.headerItem.mapOff); err != nil {
+		return err
+	}
+
+	size, err := d.readUint()
+	if err != nil {
+		return err
+	}
+	if err := d.checkSection(d.headerItem.mapOff+4, int(size), 12); err != nil {
+		return err
+	}
+
+	d.mapList = make([]mapItem, size)
+
+	for i := range d.mapList {
+		itemType, err := d.readUshort()
+		if err != nil {
+			return err
+		}
+		d.mapList[i].itemType = int(itemType)
+
+		// unused
+		if _, err = d.readUshort(); err != nil {
+			return err
+		}
+
+		count, err := d.readUint()
+		if err != nil {
+			return err
+		}
+		d.mapList[i].size = int(count)
+
+		offset, err := d.readUint()
+		if err != nil {
+			return err
+		}
+		d.mapList[i].offset = int(offset)
+		if d.mapList[i].offset > len(d.buf) {
+			return &FormatError{Offset: d.headerItem.mapOff + 4 + i*12, Index: i, Err: fmt.Errorf("section offset %d is past the end of the file", offset)}
+		}
+	}
+
+	return nil
+}
+
+// Returns the map_list entry for the given section type, if present.
+func (d *Data) findMapItem(itemType int) (mapItem, bool) {
+	for _, item := range d.mapList {
+		if item.itemType == itemType {
+			return item, true
+		}
+	}
+	return mapItem{}, false
+}
+
+// Loads the call site ID list, which was added in version 038, along with the
+// method handles held by each call_site_item.
+func (d *Data) loadCallSiteIds() error {
+	item, ok := d.findMapItem(typeCallSiteIdItem)
+	if !ok {
+		return nil
+	}
+	if d.version < 38 {
+		return fmt.Errorf("call_site_ids present in dex version %03d", d.version)
+	}
+	if err := d.checkSection(item.offset, item.size, 4); err != nil {
+		return err
+	}
+
+	if err := d.seek(item.offset); err != nil {
+		return err
+	}
+
+	d.callSites = make([]callSiteItem, item.size)
+
+	for i := 0; i < item.size; i++ {
+		callSiteOff, err := d.readUint()
+		if err != nil {
+			return err
+		}
+
+		d.callSites[i].offset = int(callSiteOff)
+	}
+
+	for i := range d.callSites {
+		callSite := &d.callSites[i]
+		if err := d.seek(callSite.offset); err != nil {
+			return err
+		}
+
+		handles, err := d.readEncodedArray(nil)
+		if err != nil {
+			return withSection("call_site_item", err)
+		}
+		for _, h := range handles {
+			if h >= len(d.methodHandles) {
+				return &FormatError{Section: "call_site_item", Offset: callSite.offset, Index: i, Err: fmt.Errorf("method handle %d is out of range [0, %d)", h, len(d.methodHandles))}
+			}
+		}
+		callSite.methodHandles = handles
+	}
+
+	return nil
+}
+
+// Loads the method handle list, which was added in version 038.
+func (d *Data) loadMethodHandles() error {
+	item, ok := d.findMapItem(typeMethodHandleItem)
+	if !ok {
+		return nil
+	}
+	if d.version < 38 {
+		return fmt.Errorf("method_handles present in dex version %03d", d.version)
+	}
+	if err := d.checkSection(item.offset, item.size, 8); err != nil {
+		return err
+	}
+
+	if err := d.seek(item.offset); err != nil {
+		return err
+	}
+
+	d.methodHandles = make([]methodHandleItem, item.size)
+
+	for i := 0; i < item.size; i++ {
+		handleType, err := d.readUshort()
+		if err != nil {
+			return err
+		}
+		if handleType > methodHandleInvokeInterface {
+			return &FormatError{Offset: item.offset + i*8, Index: i, Err: fmt.Errorf("unknown method handle type %d", handleType)}
+		}
+		d.methodHandles[i].handleType = int(handleType)
+
+		// unused
+		if _, err = d.readUshort(); err != nil {
+			return err
+		}
+
+		fieldOrMethodId, err := d.readUshort()
+		if err != nil {
+			return err
+		}
+		d.methodHandles[i].fieldOrMethodId = int(fieldOrMethodId)
+
+		limit, field := len(d.methodIds), "method_id"
+		if d.methodHandles[i].isFieldAccess() {
+			limit, field = len(d.fieldIds), "field_id"
+		}
+		if err := checkIndex("method_handles", i, item.offset+i*8, field, int(fieldOrMethodId), limit); err != nil {
+			return err
+		}
+
+		// unused
+		if _, err = d.readUshort(); err != nil {
 			return err
 		}
 	}
@@ -524,6 +1082,82 @@ func (d *Data) loadClassDefs() error {
 	return nil
 }
 
+// Checks that every index held by an ID item or class def refers to an entry
+// in the section it indexes into, so that lookups can't go out of range.
+func (d *Data) checkIndices() error {
+	numStrings := len(d.strings)
+	numTypes := len(d.typeIds)
+
+	for i, typeId := range d.typeIds {
+		offset := d.headerItem.typeIdsOff + i*4
+		if err := checkIndex("type_ids", i, offset, "descriptor_idx", int(typeId.descriptorIdx), numStrings); err != nil {
+			return err
+		}
+	}
+
+	for i, protoId := range d.protoIds {
+		offset := d.headerItem.protoIdsOff + i*12
+		if err := checkIndex("proto_ids", i, offset, "shorty_idx", int(protoId.shortyIdx), numStrings); err != nil {
+			return err
+		}
+		if err := checkIndex("proto_ids", i, offset, "return_type_idx", int(protoId.returnTypeIdx), numTypes); err != nil {
+			return err
+		}
+		for _, ty := range protoId.types {
+			if err := checkIndex("type_list", i, protoId.parametersOff, "type_idx", int(ty), numTypes); err != nil {
+				return err
+			}
+		}
+	}
+
+	for i, fieldId := range d.fieldIds {
+		offset := d.headerItem.fieldIdsOff + i*8
+		if err := checkIndex("field_ids", i, offset, "class_idx", int(fieldId.classIdx), numTypes); err != nil {
+			return err
+		}
+		if err := checkIndex("field_ids", i, offset, "type_idx", int(fieldId.typeIdx), numTypes); err != nil {
+			return err
+		}
+		if err := checkIndex("field_ids", i, offset, "name_idx", int(fieldId.nameIdx), numStrings); err != nil {
+			return err
+		}
+	}
+
+	for i, methodId := range d.methodIds {
+		offset := d.headerItem.methodIdsOff + i*8
+		if err := checkIndex("method_ids", i, offset, "class_idx", int(methodId.classIdx), numTypes); err != nil {
+			return err
+		}
+		if err := checkIndex("method_ids", i, offset, "proto_idx", int(methodId.protoIdx), len(d.protoIds)); err != nil {
+			return err
+		}
+		if err := checkIndex("method_ids", i, offset, "name_idx", int(methodId.nameIdx), numStrings); err != nil {
+			return err
+		}
+	}
+
+	for i, classDef := range d.classDefs {
+		offset := d.headerItem.classDefsOff + i*32
+		if err := checkIndex("class_defs", i, offset, "class_idx", int(classDef.classIdx), numTypes); err != nil {
+			return err
+		}
+		if classDef.superclassIdx != noIndex {
+			if err := checkIndex("class_defs", i, offset, "superclass_idx", int(classDef.superclassIdx), numTypes); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func checkIndex(section string, item, offset int, field string, idx, limit int) error {
+	if idx < 0 || idx >= limit {
+		return &FormatError{Section: section, Offset: offset, Index: item, Err: fmt.Errorf("%s %d is out of range [0, %d)", field, idx, limit)}
+	}
+	return nil
+}
+
 // Sets the "internal" flag on type IDs which are defined in the DEX file or
 // within  the VM (e.g. primitive classes and arrays).
 func (d *Data) markInternalClasses() {
@@ -531,10 +1165,13 @@ func (d *Data) markInternalClasses() {
 		d.typeIds[classDef.classIdx].internal = true
 	}
 
-	for _, typeId := range d.typeIds {
+	for i := range d.typeIds {
+		typeId := &d.typeIds[i]
 		className := d.strings[typeId.descriptorIdx]
 
-		if len(className) == 1 {
+		if len(className) == 0 {
+			continue
+		} else if len(className) == 1 {
 			// primitive class
 			typeId.internal = true
 		} else if className[0] == '[' {
@@ -543,20 +1180,88 @@ func (d *Data) markInternalClasses() {
 	}
 }
 
-// Verifies the given magic number.
-func verifyMagic(magic []byte) bool {
-	dexFileMagic := []byte{0x64, 0x65, 0x78, 0x0a, 0x30, 0x33, 0x36, 0x00}
-	dexFileMagicApi13 := []byte{0x64, 0x65, 0x78, 0x0a, 0x30, 0x33, 0x35, 0x00}
-	return bytes.Equal(magic, dexFileMagic) || bytes.Equal(magic, dexFileMagicApi13)
+// Parses the descriptor of each type ID, and the parameters of each proto ID,
+// once, so that the references which use them can share the results.
+func (d *Data) parseTypes() {
+	for i := range d.typeIds {
+		typeId := &d.typeIds[i]
+		typeId.parsed = TypeOf(d.strings[typeId.descriptorIdx])
+	}
+
+	for i := range d.protoIds {
+		protoId := &d.protoIds[i]
+		if len(protoId.types) == 0 {
+			continue
+		}
+
+		protoId.params = make([]Type, len(protoId.types))
+		for j, ty := range protoId.types {
+			protoId.params[j] = d.typeIds[ty].parsed
+		}
+	}
+}
+
+// Verifies the given magic number and extracts the format version from it. The
+// magic is "dex\n" followed by a three digit version and a NUL byte.
+func parseMagic(magic []byte) (int, bool) {
+	dexFileMagicPrefix := []byte{0x64, 0x65, 0x78, 0x0a}
+	if len(magic) != 8 || !bytes.Equal(magic[:4], dexFileMagicPrefix) || magic[7] != 0x00 {
+		return 0, false
+	}
+
+	version := 0
+	for _, ch := range magic[4:7] {
+		if ch < '0' || ch > '9' {
+			return 0, false
+		}
+		version = version*10 + int(ch-'0')
+	}
+
+	return version, true
 }
 
 // Queries
 
-func (d *Data) classNameFromTypeIndex(idx int16) string {
+// Returns the version of the DEX format the file was written in, e.g. 35 for
+// "dex\n035".
+func (d *Data) Version() int {
+	return d.version
+}
+
+// The number of entries in each of the ID sections which are indexed with 16
+// bits by instructions, and so are subject to the 65,536 entry limit.
+type IdCounts struct {
+	Strings int
+	Types   int
+	Protos  int
+	Fields  int
+	Methods int
+
+	// Referenced by invoke-custom and const-method-handle. Always zero before
+	// version 038.
+	CallSites     int
+	MethodHandles int
+}
+
+// Returns the sizes of the ID sections. Those in the header are taken from
+// there, and the rest from the map_list.
+func (d *Data) IdCounts() IdCounts {
+	return IdCounts{
+		Strings:       d.headerItem.stringIdsSize,
+		Types:         d.headerItem.typeIdsSize,
+		Protos:        d.headerItem.protoIdsSize,
+		Fields:        d.headerItem.fieldIdsSize,
+		Methods:       d.headerItem.methodIdsSize,
+		CallSites:     len(d.callSites),
+		MethodHandles: len(d.methodHandles),
+	}
+}
+
+func (d *Data) classNameFromTypeIndex(idx uint16) string {
 	return d.strings[d.typeIds[idx].descriptorIdx]
 }
 
-func (d *Data) argArrayFromProtoIndex(idx int16) []string {
+func (d *Data) argArrayFromProtoIndex(idx uint16) []string {
 	protoId := d.protoIds[idx]
 
 	result := make([]string, len(protoId.types))
@@ -568,217 +1273,255 @@ func (d *Data) argArrayFromProtoIndex(idx int16) []string {
 	return result
 }
 
-func (d *Data) returnTypeFromProtoIndex(idx int16) string {
+func (d *Data) returnTypeFromProtoIndex(idx uint16) string {
 	protoId := d.protoIds[idx]
 	return d.strings[d.typeIds[protoId.returnTypeIdx].descriptorIdx]
 }
 
-// Returns a slice with all of the class references that don't correspond to
-// classes in the DEX file.  Each class reference has a list of the referenced
-// fields and methods associated with that class.
-func (d *Data) GetExternalReferences() []ClassRef {
-	// create a sparse array of ClassRef that parallels d.typeIds
-	sparseRefs := make([]ClassRef, len(d.typeIds))
-
-	// create entries for all externally-referenced classes
-	count := 0
-	for i, typeId := range d.typeIds {
-		if !typeId.internal {
-			sparseRefs[i] = ClassRef{ClassName: d.strings[typeId.descriptorIdx]}
-			count++
-		}
+func (d *Data) GetMethodRefs() []MethodRef {
+	methodRefs := make([]MethodRef, len(d.methodIds))
+	for i := range d.methodIds {
+		methodRefs[i] = d.methodRefFromIndex(i)
 	}
+	return methodRefs
+}
 
-	// add fields and methods to the appropriate class entry
-	d.addExternalFieldReferences(sparseRefs)
-	d.addExternalMethodReferences(sparseRefs)
+func (d *Data) GetFieldRefs() []FieldRef {
+	fieldRefs := make([]FieldRef, len(d.fieldIds))
+	for i := range d.fieldIds {
+		fieldRefs[i] = d.fieldRefFromIndex(i)
+	}
+	return fieldRefs
+}
 
-	// crunch out the sparseness
-	classRefs := make([]ClassRef, count)
-	idx := 0
-	for i, _ := range d.typeIds {
-		ref := sparseRefs[i]
-		if ref.ClassName != "" || len(ref.FieldRefs) != 0 || len(ref.MethodRefs) != 0 {
-			classRefs[idx] = sparseRefs[i]
-			idx++
-		}
+func (d *Data) methodRefFromIndex(idx int) MethodRef {
+	methodId := d.methodIds[idx]
+	protoId := d.protoIds[methodId.protoIdx]
+	return MethodRef{
+		DeclClass:  d.classNameFromTypeIndex(methodId.classIdx),
+		ArgTypes:   d.argArrayFromProtoIndex(methodId.protoIdx),
+		ReturnType: d.returnTypeFromProtoIndex(methodId.protoIdx),
+		MethodName: d.strings[methodId.nameIdx],
+		class:      d.typeIds[methodId.classIdx].parsed,
+		params:     protoId.params,
+		ret:        d.typeIds[protoId.returnTypeIdx].parsed,
 	}
+}
 
-	return classRefs
+func (d *Data) fieldRefFromIndex(idx int) FieldRef {
+	fieldId := d.fieldIds[idx]
+	return FieldRef{
+		DeclClass: d.classNameFromTypeIndex(fieldId.classIdx),
+		FieldType: d.classNameFromTypeIndex(fieldId.typeIdx),
+		FieldName: d.strings[fieldId.nameIdx],
+		class:     d.typeIds[fieldId.classIdx].parsed,
+		typ:       d.typeIds[fieldId.typeIdx].parsed,
+	}
 }
 
-// Runs through the list of field references, inserting external references
-// into the appropriate ClassRef.
-func (d *Data) addExternalFieldReferences(sparseRefs []ClassRef) {
-	for _, fieldId := range d.fieldIds {
-		if !d.typeIds[fieldId.classIdx].internal {
-			newFieldRef := FieldRef{
-				DeclClass: d.classNameFromTypeIndex(fieldId.classIdx),
-				FieldType: d.classNameFromTypeIndex(fieldId.typeIdx),
-				FieldName: d.strings[fieldId.nameIdx],
-			}
+// Returns the classes defined in the DEX file, along with the fields and
+// methods each one defines, as listed in its class_data_item.
+func (d *Data) GetClassDefs() []ClassDef {
+	classDefs := make([]ClassDef, len(d.classDefs))
+
+	for i, classDef := range d.classDefs {
+		c := ClassDef{
+			ClassName:   d.strings[d.typeIds[classDef.classIdx].descriptorIdx],
+			AccessFlags: classDef.accessFlags,
+		}
+		if classDef.superclassIdx != noIndex {
+			c.SuperClass = d.strings[d.typeIds[classDef.superclassIdx].descriptorIdx]
+		}
+		for _, typeIdx := range classDef.annotations {
+			c.Annotations = append(c.Annotations, d.strings[d.typeIds[typeIdx].descriptorIdx])
+		}
+
+		for _, field := range classDef.staticFields {
+			c.Fields = append(c.Fields, DefinedField{
+				FieldRef:    d.fieldRefFromIndex(field.fieldIdx),
+				AccessFlags: field.accessFlags,
+			})
+		}
+		for _, field := range classDef.instanceFields {
+			c.Fields = append(c.Fields, DefinedField{
+				FieldRef:    d.fieldRefFromIndex(field.fieldIdx),
+				AccessFlags: field.accessFlags,
+			})
+		}
 
-			classRef := sparseRefs[fieldId.classIdx]
-			classRef.FieldRefs = append(classRef.FieldRefs, newFieldRef)
+		for _, method := range classDef.directMethods {
+			c.Methods = append(c.Methods, d.definedMethod(method))
+		}
+		for _, method := range classDef.virtualMethods {
+			c.Methods = append(c.Methods, d.definedMethod(method))
 		}
+
+		classDefs[i] = c
 	}
+
+	return classDefs
 }
 
-// Runs through the list of method references, inserting external references
-// into the appropriate ClassRef.
-func (d *Data) addExternalMethodReferences(sparseRefs []ClassRef) {
-	for _, methodId := range d.methodIds {
-		if !d.typeIds[methodId.classIdx].internal {
-			newMethodRef := MethodRef{
-				DeclClass:  d.classNameFromTypeIndex(methodId.classIdx),
-				ArgTypes:   d.argArrayFromProtoIndex(methodId.protoIdx),
-				ReturnType: d.returnTypeFromProtoIndex(methodId.protoIdx),
-				MethodName: d.strings[methodId.nameIdx],
-			}
+func (d *Data) definedMethod(method encodedMethod) DefinedMethod {
+	m := DefinedMethod{
+		MethodRef:   d.methodRefFromIndex(method.methodIdx),
+		AccessFlags: method.accessFlags,
+	}
 
-			classRef := sparseRefs[methodId.classIdx]
-			classRef.MethodRefs = append(classRef.MethodRefs, newMethodRef)
+	if method.code != nil {
+		m.Code = &CodeItem{
+			RegistersSize: method.code.registersSize,
+			InsSize:       method.code.insSize,
+			OutsSize:      method.code.outsSize,
+			Tries:         method.code.tries,
+			DebugInfoOff:  method.code.debugInfoOff,
+			InsnsSize:     method.code.insnsSize,
 		}
 	}
+
+	return m
 }
 
-func (d *Data) GetMethodRefs() []MethodRef {
-	methodRefs := make([]MethodRef, len(d.methodIds))
-	for i, methodId := range d.methodIds {
-		methodRefs[i] = MethodRef{
-			DeclClass:  d.classNameFromTypeIndex(methodId.classIdx),
-			ArgTypes:   d.argArrayFromProtoIndex(methodId.protoIdx),
-			ReturnType: d.returnTypeFromProtoIndex(methodId.protoIdx),
-			MethodName: d.strings[methodId.nameIdx],
+// Returns the methods which are defined by a class in the DEX file.
+func (d *Data) GetDefinedMethodRefs() []MethodRef {
+	methodRefs := make([]MethodRef, 0)
+	for _, classDef := range d.classDefs {
+		for _, method := range classDef.directMethods {
+			methodRefs = append(methodRefs, d.methodRefFromIndex(method.methodIdx))
+		}
+		for _, method := range classDef.virtualMethods {
+			methodRefs = append(methodRefs, d.methodRefFromIndex(method.methodIdx))
 		}
 	}
 	return methodRefs
 }
 
-func (d *Data) GetFieldRefs() []FieldRef {
-	fieldRefs := make([]FieldRef, len(d.fieldIds))
-	for i, fieldId := range d.fieldIds {
-		fieldRefs[i] = FieldRef{
-			DeclClass: d.classNameFromTypeIndex(fieldId.classIdx),
-			FieldType: d.classNameFromTypeIndex(fieldId.typeIdx),
-			FieldName: d.strings[fieldId.nameIdx],
+// Returns the fields which are defined by a class in the DEX file.
+func (d *Data) GetDefinedFieldRefs() []FieldRef {
+	fieldRefs := make([]FieldRef, 0)
+	for _, classDef := range d.classDefs {
+		for _, field := range classDef.staticFields {
+			fieldRefs = append(fieldRefs, d.fieldRefFromIndex(field.fieldIdx))
+		}
+		for _, field := range classDef.instanceFields {
+			fieldRefs = append(fieldRefs, d.fieldRefFromIndex(field.fieldIdx))
 		}
 	}
 	return fieldRefs
 }
 
 // Basic I/O Functions
-func readFully(f os.File, buf []byte) error {
-	n, err := f.Read(buf)
-	if err != nil {
-		return err
+
+// Moves the position of the next read to the given file offset.
+func (d *Data) seek(offset int) error {
+	if offset < 0 || offset > len(d.buf) {
+		return &FormatError{Offset: offset, Index: -1, Err: fmt.Errorf("offset is outside of the file, which is %d bytes", len(d.buf))}
 	}
 
-	if n != len(buf) {
-		return errors.New("expected to read " + string(len(buf)) + " bytes, but only read " + string(n))
+	d.pos = offset
+	return nil
+}
+
+// Checks that count items of itemSize bytes starting at offset lie within the
+// file, so that a corrupt count can't cause a huge allocation.
+func (d *Data) checkSection(offset, count, itemSize int) error {
+	if count == 0 {
+		return nil
 	}
 
+	if count < 0 || offset < 0 || offset > len(d.buf) || count > (len(d.buf)-offset)/itemSize {
+		return &FormatError{Offset: offset, Index: -1, Err: fmt.Errorf("%d items of %d bytes don't fit in the file", count, itemSize)}
+	}
 	return nil
 }
 
-func readByte(f os.File, buf []byte) (byte, error) {
-	n, err := f.Read(buf)
-	if err != nil {
-		return 0, err
+// Returns the next n bytes of the file, without copying them.
+func (d *Data) readBytes(n int) ([]byte, error) {
+	if n < 0 || n > len(d.buf)-d.pos {
+		return nil, &FormatError{Offset: d.pos, Index: -1, Err: io.ErrUnexpectedEOF}
 	}
 
-	if n != len(buf) {
-		err = errors.New("expected to read " + string(len(buf)) + " bytes, but only read " + string(n))
+	b := d.buf[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *Data) readByte() (byte, error) {
+	b, err := d.readBytes(1)
+	if err != nil {
 		return 0, err
 	}
 
-	return buf[0], nil
+	return b[0], nil
 }
 
 // Reads a variable-length unsigned LEB128 value. Does not attempt to verify
 // that the value is valid.
-func readUnsignedLeb128(f os.File, buf []byte) (uint32, error) {
+func (d *Data) readUnsignedLeb128() (uint32, error) {
 	result := uint32(0)
+	shift := uint(0)
 	var val byte = 0x80
 	var err error
 
-	// Stop when the highest bit is clear
+	// Stop when the highest bit is clear. The low-order group comes first.
 	for val >= 0x80 {
-		val, err = readByte(f, buf)
+		val, err = d.readByte()
 		if err != nil {
 			return 0, err
 		}
 
-		result = (result << 7) | uint32(val&0x7f)
+		result |= uint32(val&0x7f) << shift
+		shift += 7
 	}
 
 	return result, nil
 }
 
-// Reads a UTF-8 string.
-//
-// We don't know how long the UTF-8 string is, so we have to read one byte at a
-// time.  We could make an educated guess based on the utf16_size and seek back
-// if we get it wrong, but seeking backward may cause the underlying
-// implementation to reload I/O buffers.
-func readString(f os.File, buf []byte) (string, error) {
-	utf16len, err := readUnsignedLeb128(f, buf)
-	//fmt.Println(utf16len)
+// Reads a string_data_item: the length of the string in UTF-16 code units,
+// followed by its NUL-terminated Modified UTF-8 bytes.
+func (d *Data) readString() (string, error) {
+	utf16Size, err := d.readUnsignedLeb128()
 	if err != nil {
 		return "", err
 	}
 
-	inBuf := make([]byte, utf16len*3) // worst case
-	var idx int
-
-	for idx = 0; idx < len(inBuf); idx++ {
-		val, err := readByte(f, buf)
-		if err != nil {
-			return "", err
-		}
-
-		if val == 0x00 {
-			break
-		}
-		inBuf[idx] = val
+	start := d.pos
+	end := bytes.IndexByte(d.buf[start:], 0x00)
+	if end < 0 {
+		return "", &FormatError{Offset: start, Index: -1, Err: errors.New("string isn't terminated")}
 	}
 
-	return string(inBuf[:idx]), nil
-}
-
-// Reads a signed 16-bit integer, byte-swapping if necessary
-func (d *Data) readShort() (int16, error) {
-	if err := readFully(d.dexFile, d.tmpShortBuf); err != nil {
-		return -1, err
+	str, err := mutf8.Decode(d.buf[start : start+end])
+	if err != nil {
+		return "", &FormatError{Offset: start, Index: -1, Err: err}
 	}
-
-	buf := bytes.NewBuffer(d.tmpShortBuf)
-	var ret int16
-	if d.isBigEndian {
-		binary.Read(buf, binary.BigEndian, &ret)
-	} else {
-		binary.Read(buf, binary.LittleEndian, &ret)
+	if units := mutf8.UTF16Len(str); units != int(utf16Size) {
+		return "", &FormatError{Offset: start, Index: -1, Err: fmt.Errorf("string has %d UTF-16 code units, but its utf16_size is %d", units, utf16Size)}
 	}
 
-	return ret, nil
+	d.pos = start + end + 1
+	return str, nil
 }
 
-// Reads a signed 32-bit integer, byte-swapping if necessary
-func (d *Data) readInt() (int, error) {
-	err := readFully(d.dexFile, d.tmpBuf)
+// Reads an unsigned 16-bit integer, byte-swapping if necessary. Every
+// ushort in the format, e.g. the type_idx of a field_id_item, is unsigned.
+func (d *Data) readUshort() (uint16, error) {
+	b, err := d.readBytes(2)
 	if err != nil {
-		return -1, err
+		return 0, err
 	}
 
-	buf := bytes.NewBuffer(d.tmpBuf)
-	var ret int32
-	if d.isBigEndian {
-		binary.Read(buf, binary.BigEndian, &ret)
-	} else {
-		binary.Read(buf, binary.LittleEndian, &ret)
+	return d.order.Uint16(b), nil
+}
+
+// Reads an unsigned 32-bit integer, byte-swapping if necessary
+func (d *Data) readUint() (uint32, error) {
+	b, err := d.readBytes(4)
+	if err != nil {
+		return 0, err
 	}
 
-	return int(ret), nil
+	return d.order.Uint32(b), nil
 }
 
 // Internal "structure" declarations
@@ -787,7 +1530,7 @@ func (d *Data) readInt() (int, error) {
 type headerItem struct {
 	fileSize      int
 	headerSize    int
-	endianTag     int
+	endianTag     uint32
 	stringIdsSize int
 	stringIdsOff  int
 	typeIdsSize   int
@@ -800,6 +1543,7 @@ type headerItem struct {
 	methodIdsOff  int
 	classDefsSize int
 	classDefsOff  int
+	mapOff        int
 }
 
 // Holds the contents of a type_id_item.
@@ -809,31 +1553,71 @@ type headerItem struct {
 // class defined in this DEX, so we use a struct for each instead of a simple
 // integer.
 type typeIdItem struct {
-	descriptorIdx int  // index into string_ids
-	internal      bool // defined within this DEX file?
+	descriptorIdx uint32 // index into string_ids
+	internal      bool   // defined within this DEX file?
+	parsed        Type   // the parsed descriptor
 }
 
 // Holds the contents of a proto_id_item.
 type protoIdItem struct {
-	shortyIdx     int // index into string_ids
-	returnTypeIdx int // index into type_ids
-	parametersOff int // file offset to a type_list
+	shortyIdx     uint32 // index into string_ids
+	returnTypeIdx uint32 // index into type_ids
+	parametersOff int    // file offset to a type_list
 
-	types []int16 // contents of type list
+	types  []uint16 // contents of type list
+	params []Type   // the parsed types in the type list
 }
 
 // Holds the contents of a field_id_item.
 type fieldIdItem struct {
-	classIdx int16 // index into type_ids (defining class)
-	typeIdx  int16 // index into type_ids (field type)
-	nameIdx  int   // index into string_ids
+	classIdx uint16 // index into type_ids (defining class)
+	typeIdx  uint16 // index into type_ids (field type)
+	nameIdx  uint32 // index into string_ids
 }
 
 // Holds the contents of a method_id_item.
 type methodIdItem struct {
-	classIdx int16 // index into type_ids
-	protoIdx int16 // index into proto_ids
-	nameIdx  int   // index into string_ids
+	classIdx uint16 // index into type_ids
+	protoIdx uint16 // index into proto_ids
+	nameIdx  uint32 // index into string_ids
+}
+
+// Holds the contents of a map_item.
+type mapItem struct {
+	itemType int // type of the section
+	size     int // number of items in the section
+	offset   int // file offset to the start of the section
+}
+
+// Holds the offset of a call_site_item, and the method handles it passes to
+// its bootstrap method. The first of those is the bootstrap method itself.
+type callSiteItem struct {
+	offset        int
+	methodHandles []int // indices into method_handles
+}
+
+// Method handle types. Those up to methodHandleInstanceGet access a field, and
+// the rest invoke a method.
+const (
+	methodHandleStaticPut         = 0x00
+	methodHandleStaticGet         = 0x01
+	methodHandleInstancePut       = 0x02
+	methodHandleInstanceGet       = 0x03
+	methodHandleInvokeStatic      = 0x04
+	methodHandleInvokeInstance    = 0x05
+	methodHandleInvokeConstructor = 0x06
+	methodHandleInvokeDirect      = 0x07
+	methodHandleInvokeInterface   = 0x08
+)
+
+// Holds the contents of a method_handle_item.
+type methodHandleItem struct {
+	handleType      int // one of the method handle type codes
+	fieldOrMethodId int // index into field_ids or method_ids, per handleType
+}
+
+func (h methodHandleItem) isFieldAccess() bool {
+	return h.handleType <= methodHandleInstanceGet
 }
 
 // Holds the contents of a class_def_item.
@@ -841,5 +1625,46 @@ type methodIdItem struct {
 // We don't really need a class for this, but there's some stuff in the
 // class_def_item that we might want later.
 type classDefItem struct {
-	classIdx int // index into type_ids
+	classIdx      uint32 // index into type_ids
+	accessFlags   uint32 // access flags of the class
+	superclassIdx uint32 // index into type_ids, or noIndex
+	classDataOff  int    // file offset to a class_data_item, or 0
+
+	annotationsOff int      // file offset to an annotations_directory_item, or 0
+	annotations    []uint32 // type_ids of the annotations on the class
+
+	// contents of the class_data_item
+	staticFields   []encodedField
+	instanceFields []encodedField
+	directMethods  []encodedMethod
+	virtualMethods []encodedMethod
+}
+
+// Holds the contents of an encoded_field.
+type encodedField struct {
+	fieldIdx    int // index into field_ids
+	accessFlags uint32
+}
+
+// Holds the contents of an encoded_method.
+type encodedMethod struct {
+	methodIdx   int // index into method_ids
+	accessFlags uint32
+	codeOff     int // file offset to a code_item, or 0 if abstract or native
+
+	code *codeItem // header of the code_item at codeOff, if any
+}
+
+// The size of the fields of a code_item which precede insns.
+const codeItemHeaderSize = 16
+
+// Holds the header of a code_item.
+type codeItem struct {
+	registersSize int
+	insSize       int
+	outsSize      int
+	tries         []TryItem
+	debugInfoOff  int // file offset to a debug_info_item, or 0
+	insnsSize     int // in 16-bit code units
+	insnsOff      int // file offset to the first instruction
 }
@@ -0,0 +1,154 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// Checks which types are marked as defined in the file or by the VM, rather
+// than referenced from elsewhere.
+func TestMarkInternalClasses(t *testing.T) {
+	d, err := Parse(readFixture(t, "app.dex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	internal := make(map[string]bool)
+	for _, typeId := range d.typeIds {
+		internal[d.strings[typeId.descriptorIdx]] = typeId.internal
+	}
+
+	want := map[string]bool{
+		// Defined in the file.
+		"Lcom/example/app/MainActivity;": true,
+		"Lcom/example/util/Helper;":      true,
+		// Primitives and arrays.
+		"I":                   true,
+		"V":                   true,
+		"[Ljava/lang/String;": true,
+		// Referenced only.
+		"Landroid/app/Activity;": false,
+		"Ljava/lang/String;":     false,
+		"Lokhttp3/OkHttpClient;": false,
+	}
+	for name, wantInternal := range want {
+		got, ok := internal[name]
+		if !ok {
+			t.Errorf("%s isn't in type_ids", name)
+		} else if got != wantInternal {
+			t.Errorf("%s internal = %t, want %t", name, got, wantInternal)
+		}
+	}
+}
+
+// Builds a file with n classes, the first of which has m abstract methods, and
+// points every class def at the first one's class_data_item.
+func sharedClassDataDex(n, m int) []byte {
+	t := testDex{}
+	for i := 0; i < n; i++ {
+		t.classes = append(t.classes, testClass{name: fmt.Sprintf("Lp/C%d;", i)})
+	}
+	for j := 0; j < m; j++ {
+		t.classes[0].methods = append(t.classes[0].methods, testMethod{
+			MethodRef:   MethodRef{DeclClass: "Lp/C0;", MethodName: fmt.Sprintf("m%d", j), ReturnType: "V"},
+			accessFlags: AccPublic | AccAbstract,
+		})
+	}
+	buf := t.build()
+
+	// class_defs_off, and class_data_off within each class_def_item.
+	le := binary.LittleEndian
+	classDefsOff := int(le.Uint32(buf[0x64:]))
+	classDataOff := le.Uint32(buf[classDefsOff+24:])
+	for i := 1; i < n; i++ {
+		le.PutUint32(buf[classDefsOff+i*32+24:], classDataOff)
+	}
+
+	return buf
+}
+
+func TestSharedClassData(t *testing.T) {
+	d, err := Parse(sharedClassDataDex(3, 2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range d.GetClassDefs() {
+		if len(c.Methods) != 2 {
+			t.Errorf("%s has %d methods, want the 2 in the shared class_data_item", c.ClassName, len(c.Methods))
+		}
+	}
+}
+
+// Checks that a file can't have every class def decode the same large
+// class_data_item, which would use memory quadratic in the size of the file.
+func TestSharedClassDataBounded(t *testing.T) {
+	_, err := Parse(sharedClassDataDex(2000, 200))
+	if fe, ok := err.(*FormatError); !ok || fe.Section != "class_data_item" {
+		t.Errorf("Parse() error = %v, want a class_data_item FormatError", err)
+	}
+}
+
+func TestClassAnnotations(t *testing.T) {
+	d, err := Parse(readFixture(t, "kotlin.dex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][]string{
+		"Lcom/example/UtilsKt;":       {"Lkotlin/Metadata;"},
+		"Lcom/example/JavaKt;":        nil,
+		"Lcom/example/Foo;":           {"Lkotlin/Metadata;"},
+		"Lcom/example/Foo$Companion;": {"Lkotlin/Metadata;"},
+	}
+	classDefs := d.GetClassDefs()
+	if len(classDefs) != len(want) {
+		t.Fatalf("GetClassDefs() returned %d classes, want %d", len(classDefs), len(want))
+	}
+	for _, c := range classDefs {
+		if !reflect.DeepEqual(c.Annotations, want[c.ClassName]) {
+			t.Errorf("%s has annotations %q, want %q", c.ClassName, c.Annotations, want[c.ClassName])
+		}
+	}
+}
+
+func TestClassAnnotationTypeOutOfRange(t *testing.T) {
+	buf := readFixture(t, "kotlin.dex")
+	d, err := Parse(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Follows the first class's annotations_directory_item to its set, and
+	// the set to its first annotation_item, whose type_idx follows the
+	// visibility byte.
+	setOff := binary.LittleEndian.Uint32(buf[d.classDefs[0].annotationsOff:])
+	annotationOff := binary.LittleEndian.Uint32(buf[setOff+4:])
+	buf[annotationOff+1] = 0x7f
+
+	_, err = Parse(buf)
+	var formatErr *FormatError
+	if !errors.As(err, &formatErr) || formatErr.Section != "annotation_item" {
+		t.Errorf("Parse() = %v, want an annotation_item FormatError", err)
+	}
+}
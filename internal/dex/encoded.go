@@ -0,0 +1,129 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import "fmt"
+
+// Types of encoded_value.
+const (
+	valueByte         = 0x00
+	valueShort        = 0x02
+	valueChar         = 0x03
+	valueInt          = 0x04
+	valueLong         = 0x06
+	valueFloat        = 0x10
+	valueDouble       = 0x11
+	valueMethodType   = 0x15
+	valueMethodHandle = 0x16
+	valueString       = 0x17
+	valueType         = 0x18
+	valueField        = 0x19
+	valueMethod       = 0x1a
+	valueEnum         = 0x1b
+	valueArray        = 0x1c
+	valueAnnotation   = 0x1d
+	valueNull         = 0x1e
+	valueBoolean      = 0x1f
+)
+
+// Reads an encoded_array, and appends the method_handles index of each method
+// handle in it to handles. Nested arrays and annotations are searched too.
+// Every other value is skipped.
+func (d *Data) readEncodedArray(handles []int) ([]int, error) {
+	size, err := d.readUnsignedLeb128()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := uint32(0); i < size; i++ {
+		if handles, err = d.readEncodedValue(handles); err != nil {
+			return nil, err
+		}
+	}
+
+	return handles, nil
+}
+
+// Reads an encoded_annotation, appending the method handles in it as
+// readEncodedArray does.
+func (d *Data) readEncodedAnnotation(handles []int) ([]int, error) {
+	// type_idx
+	if _, err := d.readUnsignedLeb128(); err != nil {
+		return nil, err
+	}
+
+	size, err := d.readUnsignedLeb128()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := uint32(0); i < size; i++ {
+		// name_idx
+		if _, err := d.readUnsignedLeb128(); err != nil {
+			return nil, err
+		}
+		if handles, err = d.readEncodedValue(handles); err != nil {
+			return nil, err
+		}
+	}
+
+	return handles, nil
+}
+
+// Reads an encoded_value. Its header byte holds the type in the low five bits,
+// and an argument in the high three, which is one less than the number of
+// bytes that follow for values which have them.
+func (d *Data) readEncodedValue(handles []int) ([]int, error) {
+	start := d.pos
+	header, err := d.readByte()
+	if err != nil {
+		return nil, err
+	}
+	kind, valueArg := header&0x1f, int(header>>5)
+
+	switch kind {
+	case valueNull, valueBoolean:
+		// The value, if any, is held in valueArg.
+		return handles, nil
+	case valueArray:
+		return d.readEncodedArray(handles)
+	case valueAnnotation:
+		return d.readEncodedAnnotation(handles)
+	case valueByte, valueShort, valueChar, valueInt, valueLong, valueFloat, valueDouble,
+		valueMethodType, valueString, valueType, valueField, valueMethod, valueEnum:
+		_, err := d.readBytes(valueArg + 1)
+		return handles, err
+	case valueMethodHandle:
+		b, err := d.readBytes(valueArg + 1)
+		if err != nil {
+			return nil, err
+		}
+
+		// Indices are little-endian, and zero-extended to 32 bits.
+		if len(b) > 4 {
+			return nil, &FormatError{Offset: start, Index: -1, Err: fmt.Errorf("method handle index is %d bytes long", len(b))}
+		}
+		idx := 0
+		for i, v := range b {
+			idx |= int(v) << (8 * i)
+		}
+		return append(handles, idx), nil
+	default:
+		return nil, &FormatError{Offset: start, Index: -1, Err: fmt.Errorf("unknown encoded_value type 0x%02x", kind)}
+	}
+}
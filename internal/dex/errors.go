@@ -0,0 +1,51 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import "fmt"
+
+// Describes why a DEX file couldn't be parsed, and where the problem is.
+type FormatError struct {
+	// The section being read, named as in the DEX format documentation, e.g.
+	// "type_ids" or "class_data_item".
+	Section string
+	// The file offset of the problem, or -1 if it isn't known.
+	Offset int
+	// The index of the item within its section, or -1 if it isn't known.
+	Index int
+	Err   error
+}
+
+func (e *FormatError) Error() string {
+	msg := "dex"
+	if e.Section != "" {
+		msg += " " + e.Section
+	}
+	if e.Index >= 0 {
+		msg += fmt.Sprintf(" item %d", e.Index)
+	}
+	if e.Offset >= 0 {
+		msg += fmt.Sprintf(" at offset %#x", e.Offset)
+	}
+
+	return msg + ": " + e.Err.Error()
+}
+
+func (e *FormatError) Unwrap() error {
+	return e.Err
+}
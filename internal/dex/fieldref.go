@@ -23,4 +23,36 @@ type FieldRef struct {
 	// The type name. Examples: "Ljava/lang/String;", "[I".
 	FieldType string
 	FieldName string
+
+	// The parsed types of the field, set when it's read from a DEX file so
+	// that they're only parsed once. They're ignored once they no longer match
+	// the descriptors above, e.g. after an obfuscated name is restored.
+	class Type
+	typ   Type
+}
+
+// Returns the parsed type of the field's declaring class.
+func (f FieldRef) Class() Type {
+	return parsedType(f.class, f.DeclClass)
+}
+
+// Returns the parsed type of the field.
+func (f FieldRef) Type() Type {
+	return parsedType(f.typ, f.FieldType)
+}
+
+// A comparable form of a FieldRef, for use as a map key. Unlike the FieldRef
+// itself, it doesn't depend on whether the types have been parsed.
+type FieldRefKey struct {
+	DeclClass string
+	FieldType string
+	FieldName string
+}
+
+func (f FieldRef) Key() FieldRefKey {
+	return FieldRefKey{
+		DeclClass: f.DeclClass,
+		FieldType: f.FieldType,
+		FieldName: f.FieldName,
+	}
 }
@@ -0,0 +1,270 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the fixtures in testdata")
+
+// The DEX files in testdata. They're committed so that they can seed the fuzz
+// targets and be shared with benchmarks in other packages, and are rebuilt
+// with "go test -run TestFixtures -update".
+var fixtures = map[string]testDex{
+	"app.dex":    appDex(35),
+	"app39.dex":  appDex(39),
+	"bench.dex":  benchDex(),
+	"kotlin.dex": kotlinDex(),
+}
+
+// A small app, with a few classes whose code references each other and the
+// framework. From version 038, the activity also creates a lambda, through a
+// call site, and from 039 it loads a method handle.
+func appDex(version int) testDex {
+	const (
+		activity     = "Lcom/example/app/MainActivity;"
+		helper       = "Lcom/example/util/Helper;"
+		baseActivity = "Landroid/app/Activity;"
+		object       = "Ljava/lang/Object;"
+	)
+
+	newCall := MethodRef{DeclClass: "Lokhttp3/OkHttpClient;", MethodName: "newCall", ArgTypes: []string{"Lokhttp3/Request;"}, ReturnType: "Lokhttp3/Call;"}
+	systemOut := FieldRef{DeclClass: "Ljava/lang/System;", FieldName: "out", FieldType: "Ljava/io/PrintStream;"}
+	count := FieldRef{DeclClass: activity, FieldName: "count", FieldType: "I"}
+	format := MethodRef{DeclClass: helper, MethodName: "format", ArgTypes: []string{"I", "[Ljava/lang/String;"}, ReturnType: "Ljava/lang/String;"}
+	valueOf := MethodRef{DeclClass: "Ljava/lang/String;", MethodName: "valueOf", ArgTypes: []string{"I"}, ReturnType: "Ljava/lang/String;"}
+
+	t := testDex{
+		version: version,
+		classes: []testClass{
+			{
+				name:       activity,
+				superClass: baseActivity,
+				fields:     []FieldRef{count},
+				methods: []testMethod{
+					{
+						MethodRef:   MethodRef{DeclClass: activity, MethodName: "<init>", ReturnType: "V"},
+						accessFlags: AccPublic | AccConstructor,
+						calls:       []MethodRef{{DeclClass: baseActivity, MethodName: "<init>", ReturnType: "V"}},
+					},
+					{
+						MethodRef:   MethodRef{DeclClass: activity, MethodName: "onCreate", ArgTypes: []string{"Landroid/os/Bundle;"}, ReturnType: "V"},
+						accessFlags: AccProtected,
+						calls:       []MethodRef{newCall, format},
+						gets:        []FieldRef{systemOut, count},
+					},
+				},
+			},
+			{
+				name:       helper,
+				superClass: object,
+				methods: []testMethod{
+					{
+						MethodRef:   format,
+						accessFlags: AccPublic | AccStatic,
+						calls:       []MethodRef{valueOf},
+					},
+					{
+						MethodRef:   MethodRef{DeclClass: helper, MethodName: "run", ReturnType: "V"},
+						accessFlags: AccPublic | AccAbstract,
+					},
+				},
+			},
+		},
+	}
+
+	if version >= 38 {
+		lambda := MethodRef{DeclClass: activity, MethodName: "lambda$onCreate$0", ReturnType: "V"}
+		t.classes[0].methods = append(t.classes[0].methods, testMethod{
+			MethodRef:   lambda,
+			accessFlags: AccPrivate | AccStatic | AccSynthetic,
+			calls:       []MethodRef{format},
+		})
+		t.callSites = []testCallSite{{
+			bootstrap:  lambdaMetafactory,
+			name:       "run",
+			methodType: MethodRef{ReturnType: "Ljava/lang/Runnable;"},
+			handles:    []MethodRef{lambda},
+		}}
+		t.classes[0].methods[1].customCalls = []int{0}
+	}
+	if version >= 39 {
+		t.classes[0].methods[1].handles = []MethodRef{valueOf}
+	}
+
+	return t
+}
+
+// The bootstrap method of call sites which create lambdas.
+var lambdaMetafactory = MethodRef{
+	DeclClass:  "Ljava/lang/invoke/LambdaMetafactory;",
+	MethodName: "metafactory",
+	ArgTypes: []string{
+		"Ljava/lang/invoke/MethodHandles$Lookup;",
+		"Ljava/lang/String;",
+		"Ljava/lang/invoke/MethodType;",
+		"Ljava/lang/invoke/MethodType;",
+		"Ljava/lang/invoke/MethodHandle;",
+		"Ljava/lang/invoke/MethodType;",
+	},
+	ReturnType: "Ljava/lang/invoke/CallSite;",
+}
+
+// A few Kotlin classes, which are annotated with kotlin.Metadata, alongside a
+// Java class whose name ends in "Kt" like a file facade.
+func kotlinDex() testDex {
+	const (
+		metadata  = "Lkotlin/Metadata;"
+		object    = "Ljava/lang/Object;"
+		str       = "Ljava/lang/String;"
+		foo       = "Lcom/example/Foo;"
+		companion = "Lcom/example/Foo$Companion;"
+	)
+
+	checkNotNull := MethodRef{DeclClass: "Lkotlin/jvm/internal/Intrinsics;", MethodName: "checkNotNullParameter", ArgTypes: []string{object, str}, ReturnType: "V"}
+	listOf := MethodRef{DeclClass: "Lkotlin/collections/CollectionsKt;", MethodName: "listOf", ArgTypes: []string{object}, ReturnType: "Ljava/util/List;"}
+	bar := MethodRef{DeclClass: foo, MethodName: "bar", ArgTypes: []string{"I"}, ReturnType: "V"}
+
+	return testDex{
+		classes: []testClass{
+			{
+				name:        "Lcom/example/UtilsKt;",
+				superClass:  object,
+				annotations: []string{metadata},
+				methods: []testMethod{{
+					MethodRef:   MethodRef{DeclClass: "Lcom/example/UtilsKt;", MethodName: "format", ArgTypes: []string{str}, ReturnType: "Ljava/util/List;"},
+					accessFlags: AccPublic | AccStatic | AccFinal,
+					calls:       []MethodRef{checkNotNull, listOf},
+				}},
+			},
+			{
+				name:       "Lcom/example/JavaKt;",
+				superClass: object,
+				methods: []testMethod{{
+					MethodRef:   MethodRef{DeclClass: "Lcom/example/JavaKt;", MethodName: "run", ReturnType: "V"},
+					accessFlags: AccPublic | AccStatic,
+				}},
+			},
+			{
+				name:        foo,
+				superClass:  object,
+				annotations: []string{metadata},
+				methods: []testMethod{
+					{MethodRef: bar, accessFlags: AccPublic | AccFinal},
+					{
+						MethodRef:   MethodRef{DeclClass: foo, MethodName: "bar$default", ArgTypes: []string{foo, "I", "I", object}, ReturnType: "V"},
+						accessFlags: AccPublic | AccStatic | AccSynthetic,
+						calls:       []MethodRef{bar},
+					},
+				},
+			},
+			{
+				name:        companion,
+				superClass:  object,
+				annotations: []string{metadata},
+				methods: []testMethod{{
+					MethodRef:   MethodRef{DeclClass: companion, MethodName: "create", ReturnType: foo},
+					accessFlags: AccPublic | AccFinal,
+				}},
+			},
+		},
+	}
+}
+
+// A larger file, for benchmarks: 250 classes across 10 packages, each with 10
+// methods which call methods of other classes.
+func benchDex() testDex {
+	const numClasses = 250
+
+	className := func(i int) string {
+		return fmt.Sprintf("Lcom/example/p%d/Class%d;", i%10, i)
+	}
+	methodOf := func(class, method int) MethodRef {
+		return MethodRef{DeclClass: className(class), MethodName: fmt.Sprintf("method%d", method), ArgTypes: []string{"I", className(class)}, ReturnType: "V"}
+	}
+
+	classes := make([]testClass, numClasses)
+	for i := range classes {
+		field := FieldRef{DeclClass: className(i), FieldName: "value", FieldType: "Ljava/lang/String;"}
+
+		methods := make([]testMethod, 10)
+		for j := range methods {
+			methods[j] = testMethod{
+				MethodRef:   methodOf(i, j),
+				accessFlags: AccPublic,
+				calls: []MethodRef{
+					methodOf((i+1)%numClasses, j),
+					{DeclClass: fmt.Sprintf("Lorg/library/Lib%d;", j), MethodName: "call", ReturnType: "V"},
+				},
+				gets: []FieldRef{field},
+			}
+		}
+
+		classes[i] = testClass{
+			name:       className(i),
+			superClass: "Ljava/lang/Object;",
+			fields:     []FieldRef{field},
+			methods:    methods,
+		}
+	}
+
+	return testDex{classes: classes}
+}
+
+// Checks that the committed fixtures match what they're built from, and that
+// they parse.
+func TestFixtures(t *testing.T) {
+	for name, fixture := range fixtures {
+		path := filepath.Join("testdata", name)
+		want := fixture.build()
+
+		if *update {
+			if err := os.WriteFile(path, want, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		got, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s is out of date, run go test -run TestFixtures -update", path)
+		}
+
+		if _, err := Parse(got); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
+
+func readFixture(tb testing.TB, name string) []byte {
+	tb.Helper()
+
+	buf, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return buf
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Checks that no input makes the parser, or any query on what it parsed,
+// panic. Seeded with the fixtures in testdata.
+func FuzzParse(f *testing.F) {
+	seeds, err := filepath.Glob(filepath.Join("testdata", "*.dex"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, seed := range seeds {
+		buf, err := os.ReadFile(seed)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(buf)
+	}
+
+	f.Fuzz(func(t *testing.T, buf []byte) {
+		d, err := Parse(buf)
+		if err != nil {
+			if _, ok := err.(*FormatError); !ok {
+				t.Fatalf("error is a %T, not a *FormatError: %v", err, err)
+			}
+			return
+		}
+
+		d.GetMethodRefs()
+		d.GetFieldRefs()
+		d.GetClassDefs()
+		d.GetCodeRefs()
+		d.Sections()
+		d.Verify()
+	})
+}
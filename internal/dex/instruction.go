@@ -0,0 +1,206 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import "fmt"
+
+// The kind of index an instruction carries, which determines the table it
+// indexes into.
+type IndexKind int
+
+const (
+	IndexNone IndexKind = iota
+	IndexString
+	IndexType
+	IndexField
+	IndexMethod
+	IndexCallSite
+	IndexMethodHandle
+	IndexProto
+)
+
+// Identifiers of the pseudo-instructions which hold data for other
+// instructions, stored in the high byte of a nop.
+const (
+	packedSwitchPayload  = 0x0100
+	sparseSwitchPayload  = 0x0200
+	fillArrayDataPayload = 0x0300
+)
+
+// A decoded Dalvik instruction.
+type Instruction struct {
+	Opcode byte
+	// The position of the instruction within the method, in 16-bit code units.
+	Offset int
+	// The length of the instruction, in 16-bit code units.
+	Length int
+	// The index operand, e.g. the method_ids index of an invoke. Only set when
+	// IndexKind isn't IndexNone.
+	IndexKind IndexKind
+	Index     int
+}
+
+// Reports whether the instruction is one of the invoke-kind instructions
+// which target a method_id.
+func (i Instruction) IsInvoke() bool {
+	return i.IndexKind == IndexMethod
+}
+
+// Reports whether the instruction is one of the iget, iput, sget or sput
+// instructions.
+func (i Instruction) IsFieldAccess() bool {
+	return i.IndexKind == IndexField
+}
+
+// The length, in code units, and index kind of each opcode.
+type opcodeFormat struct {
+	length    int
+	indexKind IndexKind
+}
+
+var opcodeFormats = buildOpcodeFormats()
+
+func buildOpcodeFormats() [256]opcodeFormat {
+	var formats [256]opcodeFormat
+
+	set := func(first, last int, length int, kind IndexKind) {
+		for op := first; op <= last; op++ {
+			formats[op] = opcodeFormat{length: length, indexKind: kind}
+		}
+	}
+
+	// Unused opcodes are treated as single code units.
+	set(0x00, 0xff, 1, IndexNone)
+
+	set(0x02, 0x02, 2, IndexNone) // move/from16
+	set(0x03, 0x03, 3, IndexNone) // move/16
+	set(0x05, 0x05, 2, IndexNone) // move-wide/from16
+	set(0x06, 0x06, 3, IndexNone) // move-wide/16
+	set(0x08, 0x08, 2, IndexNone) // move-object/from16
+	set(0x09, 0x09, 3, IndexNone) // move-object/16
+	set(0x13, 0x13, 2, IndexNone) // const/16
+	set(0x14, 0x14, 3, IndexNone) // const
+	set(0x15, 0x16, 2, IndexNone) // const/high16, const-wide/16
+	set(0x17, 0x17, 3, IndexNone) // const-wide/32
+	set(0x18, 0x18, 5, IndexNone) // const-wide
+	set(0x19, 0x19, 2, IndexNone) // const-wide/high16
+	set(0x1a, 0x1a, 2, IndexString)
+	set(0x1b, 0x1b, 3, IndexString) // const-string/jumbo
+	set(0x1c, 0x1c, 2, IndexType)   // const-class
+	set(0x1f, 0x20, 2, IndexType)   // check-cast, instance-of
+	set(0x22, 0x23, 2, IndexType)   // new-instance, new-array
+	set(0x24, 0x25, 3, IndexType)   // filled-new-array(/range)
+	set(0x26, 0x26, 3, IndexNone)   // fill-array-data
+	set(0x29, 0x29, 2, IndexNone)   // goto/16
+	set(0x2a, 0x2c, 3, IndexNone)   // goto/32, packed-switch, sparse-switch
+	set(0x2d, 0x3d, 2, IndexNone)   // cmpkind, if-test, if-testz
+	set(0x44, 0x51, 2, IndexNone)   // arrayop
+	set(0x52, 0x5f, 2, IndexField)  // iinstanceop
+	set(0x60, 0x6d, 2, IndexField)  // sstaticop
+	set(0x6e, 0x72, 3, IndexMethod) // invoke-kind
+	set(0x74, 0x78, 3, IndexMethod) // invoke-kind/range
+	set(0x90, 0xaf, 2, IndexNone)   // binop
+	set(0xd0, 0xe2, 2, IndexNone)   // binop/lit16, binop/lit8
+	set(0xfa, 0xfb, 4, IndexMethod) // invoke-polymorphic(/range)
+	set(0xfc, 0xfd, 3, IndexCallSite)
+	set(0xfe, 0xfe, 2, IndexMethodHandle)
+	set(0xff, 0xff, 2, IndexProto)
+
+	return formats
+}
+
+// Walks the instructions in a method's insns array, calling fn with each one
+// in order. Payloads for switches and fill-array-data are skipped.
+func DecodeInstructions(insns []uint16, fn func(Instruction)) error {
+	offset := 0
+
+	for offset < len(insns) {
+		unit := insns[offset]
+		op := byte(unit & 0xff)
+
+		if op == 0x00 && unit != 0 {
+			length, err := payloadLength(insns, offset)
+			if err != nil {
+				return err
+			}
+			offset += length
+			continue
+		}
+
+		format := opcodeFormats[op]
+		if offset+format.length > len(insns) {
+			return fmt.Errorf("instruction 0x%02x at %d runs past the end of the method", op, offset)
+		}
+
+		insn := Instruction{
+			Opcode:    op,
+			Offset:    offset,
+			Length:    format.length,
+			IndexKind: format.indexKind,
+		}
+
+		switch {
+		case format.indexKind == IndexNone:
+		case op == 0x1b:
+			// const-string/jumbo has a 32-bit index.
+			insn.Index = int(insns[offset+1]) | int(insns[offset+2])<<16
+		default:
+			insn.Index = int(insns[offset+1])
+		}
+
+		fn(insn)
+		offset += format.length
+	}
+
+	return nil
+}
+
+// Returns the length, in code units, of the payload pseudo-instruction at
+// offset.
+func payloadLength(insns []uint16, offset int) (int, error) {
+	remaining := insns[offset:]
+	if len(remaining) < 2 {
+		return 0, fmt.Errorf("truncated payload at %d", offset)
+	}
+
+	var length int
+	switch remaining[0] {
+	case packedSwitchPayload:
+		// ident, size, first_key (2 units), targets (2 units each)
+		length = 4 + int(remaining[1])*2
+	case sparseSwitchPayload:
+		// ident, size, keys and targets (2 units each)
+		length = 2 + int(remaining[1])*4
+	case fillArrayDataPayload:
+		if len(remaining) < 4 {
+			return 0, fmt.Errorf("truncated payload at %d", offset)
+		}
+		// ident, element_width, size (2 units), data padded to a code unit
+		width := int(remaining[1])
+		size := int(remaining[2]) | int(remaining[3])<<16
+		length = 4 + (size*width+1)/2
+	default:
+		return 0, fmt.Errorf("unknown payload 0x%04x at %d", remaining[0], offset)
+	}
+
+	if length > len(remaining) {
+		return 0, fmt.Errorf("payload at %d runs past the end of the method", offset)
+	}
+
+	return length, nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func nearLimitClass(i int) string {
+	return fmt.Sprintf("Lp/C%05d;", i)
+}
+
+func nearLimitMethod(i int) MethodRef {
+	return MethodRef{DeclClass: nearLimitClass(i), MethodName: "m", ArgTypes: []string{nearLimitClass(i)}, ReturnType: "V"}
+}
+
+func nearLimitField(n, i int) FieldRef {
+	return FieldRef{DeclClass: nearLimitClass(i), FieldName: "f", FieldType: nearLimitClass((i + 1) % n)}
+}
+
+// Builds a file which references n classes, each with a method whose proto is
+// unique to it and a field, so that type, proto, method and field indices all
+// reach n-1. Method and field i belong to class i, whose type index is also i.
+// The last class is defined, and calls method n/2+1.
+func nearLimitDex(n int) testDex {
+	t := testDex{}
+	for i := 0; i < n; i++ {
+		t.methodRefs = append(t.methodRefs, nearLimitMethod(i))
+		t.fieldRefs = append(t.fieldRefs, nearLimitField(n, i))
+	}
+
+	t.classes = []testClass{{
+		name: nearLimitClass(n - 1),
+		methods: []testMethod{{
+			MethodRef:   nearLimitMethod(n - 1),
+			accessFlags: AccPublic,
+			calls:       []MethodRef{nearLimitMethod(n/2 + 1)},
+			gets:        []FieldRef{nearLimitField(n, n-2)},
+		}},
+	}}
+
+	return t
+}
+
+// Checks that indices above 32,767, which went negative when they were read as
+// int16, resolve to the right entries.
+func TestNearIndexLimit(t *testing.T) {
+	for _, n := range []int{40000, 65530} {
+		t.Run(fmt.Sprint(n), func(t *testing.T) {
+			d, err := Parse(nearLimitDex(n).build())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The classes, plus "V".
+			want := IdCounts{Methods: n, Fields: n, Types: n + 1, Protos: n, Strings: n + 4}
+			if got := d.IdCounts(); got != want {
+				t.Errorf("IdCounts() = %+v, want %+v", got, want)
+			}
+
+			methodRefs := d.GetMethodRefs()
+			fieldRefs := d.GetFieldRefs()
+			for _, i := range []int{0, 32767, 32768, n / 2, n - 1} {
+				if got, want := methodRefs[i].Key(), nearLimitMethod(i).Key(); got != want {
+					t.Errorf("method %d = %+v, want %+v", i, got, want)
+				}
+				if got, want := fieldRefs[i].Key(), nearLimitField(n, i).Key(); got != want {
+					t.Errorf("field %d = %+v, want %+v", i, got, want)
+				}
+			}
+
+			classDefs := d.GetClassDefs()
+			if len(classDefs) != 1 || classDefs[0].ClassName != nearLimitClass(n-1) {
+				t.Fatalf("GetClassDefs() = %+v, want only %s", classDefs, nearLimitClass(n-1))
+			}
+
+			codeRefs, err := d.GetCodeRefs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(codeRefs) != 1 {
+				t.Fatalf("GetCodeRefs() returned %d methods, want 1", len(codeRefs))
+			}
+			if got, want := codeRefs[0].Caller.Key(), nearLimitMethod(n-1).Key(); got != want {
+				t.Errorf("Caller = %+v, want %+v", got, want)
+			}
+			if got, want := methodKeys(codeRefs[0].MethodRefs), methodKeys([]MethodRef{nearLimitMethod(n/2 + 1)}); !reflect.DeepEqual(got, want) {
+				t.Errorf("MethodRefs = %+v, want %+v", got, want)
+			}
+			if got, want := fieldKeys(codeRefs[0].FieldRefs), fieldKeys([]FieldRef{nearLimitField(n, n-2)}); !reflect.DeepEqual(got, want) {
+				t.Errorf("FieldRefs = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestCallSitesAndMethodHandles(t *testing.T) {
+	tests := []struct {
+		fixture           string
+		wantCallSites     int
+		wantMethodHandles int
+	}{
+		{fixture: "app.dex"},
+		// The lambda's call site, with handles for its bootstrap method and
+		// body, and the handle loaded by const-method-handle.
+		{fixture: "app39.dex", wantCallSites: 1, wantMethodHandles: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.fixture, func(t *testing.T) {
+			d, err := Parse(readFixture(t, tt.fixture))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			counts := d.IdCounts()
+			if counts.CallSites != tt.wantCallSites || counts.MethodHandles != tt.wantMethodHandles {
+				t.Errorf("IdCounts() has %d call sites and %d method handles, want %d and %d",
+					counts.CallSites, counts.MethodHandles, tt.wantCallSites, tt.wantMethodHandles)
+			}
+		})
+	}
+}
+
+// Method handles and call sites were added in version 038, so earlier files
+// can't have them.
+func TestMethodHandlesBeforeVersion38(t *testing.T) {
+	dex := appDex(39)
+	dex.version = 37
+
+	_, err := Parse(dex.build())
+	if fe, ok := err.(*FormatError); !ok || fe.Section != "method_handles" {
+		t.Errorf("Parse() error = %v, want a method_handles FormatError", err)
+	}
+}
@@ -26,6 +26,13 @@ type MethodRef struct {
 	// The method's return type. Examples: "Ljava/lang/String;", "[I".
 	ReturnType string
 	MethodName string
+
+	// The parsed types of the method, set when it's read from a DEX file so
+	// that they're only parsed once. They're ignored once they no longer match
+	// the descriptors above, e.g. after an obfuscated name is restored.
+	class  Type
+	params []Type
+	ret    Type
 }
 
 func (m MethodRef) Descriptor() string {
@@ -37,3 +44,52 @@ func (m MethodRef) Descriptor() string {
 
 	return s
 }
+
+// Returns the parsed type of the method's declaring class.
+func (m MethodRef) Class() Type {
+	return parsedType(m.class, m.DeclClass)
+}
+
+// Returns the parsed types of the method's parameters.
+func (m MethodRef) Params() []Type {
+	params := make([]Type, len(m.ArgTypes))
+	for i, arg := range m.ArgTypes {
+		var parsed Type
+		if i < len(m.params) {
+			parsed = m.params[i]
+		}
+		params[i] = parsedType(parsed, arg)
+	}
+	return params
+}
+
+// Returns the parsed return type of the method.
+func (m MethodRef) Return() Type {
+	return parsedType(m.ret, m.ReturnType)
+}
+
+// Formats the method's signature as Java would, qualified by its class, e.g.
+// "com.example.Foo.bar(int, java.lang.String[])".
+func (m MethodRef) JavaSignature() string {
+	params := make([]string, len(m.ArgTypes))
+	for i, param := range m.Params() {
+		params[i] = param.String()
+	}
+
+	return m.Class().String() + "." + m.MethodName + "(" + strings.Join(params, ", ") + ")"
+}
+
+// A comparable form of a MethodRef, for use as a map key.
+type MethodRefKey struct {
+	DeclClass  string
+	MethodName string
+	Descriptor string
+}
+
+func (m MethodRef) Key() MethodRefKey {
+	return MethodRefKey{
+		DeclClass:  m.DeclClass,
+		MethodName: m.MethodName,
+		Descriptor: m.Descriptor(),
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import "sort"
+
+// Section types found in a map_list.
+const (
+	typeHeaderItem               = 0x0000
+	typeStringIdItem             = 0x0001
+	typeTypeIdItem               = 0x0002
+	typeProtoIdItem              = 0x0003
+	typeFieldIdItem              = 0x0004
+	typeMethodIdItem             = 0x0005
+	typeClassDefItem             = 0x0006
+	typeCallSiteIdItem           = 0x0007
+	typeMethodHandleItem         = 0x0008
+	typeMapList                  = 0x1000
+	typeTypeList                 = 0x1001
+	typeAnnotationSetRefList     = 0x1002
+	typeAnnotationSetItem        = 0x1003
+	typeClassDataItem            = 0x2000
+	typeCodeItem                 = 0x2001
+	typeStringDataItem           = 0x2002
+	typeDebugInfoItem            = 0x2003
+	typeAnnotationItem           = 0x2004
+	typeEncodedArrayItem         = 0x2005
+	typeAnnotationsDirectoryItem = 0x2006
+	typeHiddenapiClassDataItem   = 0xF000
+)
+
+var sectionNames = map[int]string{
+	typeHeaderItem:               "header_item",
+	typeStringIdItem:             "string_id_item",
+	typeTypeIdItem:               "type_id_item",
+	typeProtoIdItem:              "proto_id_item",
+	typeFieldIdItem:              "field_id_item",
+	typeMethodIdItem:             "method_id_item",
+	typeClassDefItem:             "class_def_item",
+	typeCallSiteIdItem:           "call_site_id_item",
+	typeMethodHandleItem:         "method_handle_item",
+	typeMapList:                  "map_list",
+	typeTypeList:                 "type_list",
+	typeAnnotationSetRefList:     "annotation_set_ref_list",
+	typeAnnotationSetItem:        "annotation_set_item",
+	typeClassDataItem:            "class_data_item",
+	typeCodeItem:                 "code_item",
+	typeStringDataItem:           "string_data_item",
+	typeDebugInfoItem:            "debug_info_item",
+	typeAnnotationItem:           "annotation_item",
+	typeEncodedArrayItem:         "encoded_array_item",
+	typeAnnotationsDirectoryItem: "annotations_directory_item",
+	typeHiddenapiClassDataItem:   "hiddenapi_class_data_item",
+}
+
+// A section of the file, as listed in its map_list.
+type Section struct {
+	// The type code of the items in the section, e.g. 0x2001 for code_item.
+	Type int
+	// The name of the item type, e.g. "code_item", or "unknown" for types
+	// which aren't in the DEX format documentation.
+	Name   string
+	Count  int
+	Offset int
+	// The number of bytes from the start of the section to the start of the
+	// next one, or to the end of the file for the last section. This includes
+	// any padding which aligns the next section.
+	Size int
+}
+
+// Returns every section in the map_list, in file order.
+func (d *Data) Sections() []Section {
+	sections := make([]Section, len(d.mapList))
+	for i, item := range d.mapList {
+		name, ok := sectionNames[item.itemType]
+		if !ok {
+			name = "unknown"
+		}
+
+		sections[i] = Section{
+			Type:   item.itemType,
+			Name:   name,
+			Count:  item.size,
+			Offset: item.offset,
+		}
+	}
+
+	sort.SliceStable(sections, func(i, j int) bool {
+		return sections[i].Offset < sections[j].Offset
+	})
+
+	for i := range sections {
+		end := len(d.buf)
+		if i+1 < len(sections) {
+			end = sections[i+1].Offset
+		}
+		sections[i].Size = end - sections[i].Offset
+	}
+
+	return sections
+}
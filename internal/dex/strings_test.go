@@ -0,0 +1,65 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestReadString(t *testing.T) {
+	tests := []struct {
+		name string
+		// A string_data_item: utf16_size, then the bytes.
+		item    []byte
+		want    string
+		wantErr bool
+	}{
+		{name: "ASCII", item: []byte{3, 'f', 'o', 'o', 0}, want: "foo"},
+		{name: "U+0000", item: []byte{1, 0xc0, 0x80, 0}, want: "\x00"},
+		{name: "supplementary", item: []byte{2, 0xed, 0xa0, 0xbd, 0xed, 0xb8, 0x80, 0}, want: "\U0001F600"},
+		// Counting the supplementary character as one code point, or its
+		// encoding as six bytes, gives the wrong size.
+		{name: "utf16_size too small", item: []byte{1, 0xed, 0xa0, 0xbd, 0xed, 0xb8, 0x80, 0}, wantErr: true},
+		{name: "utf16_size too large", item: []byte{6, 0xed, 0xa0, 0xbd, 0xed, 0xb8, 0x80, 0}, wantErr: true},
+		{name: "unterminated", item: []byte{3, 'f', 'o', 'o'}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Data{buf: tt.item, order: binary.LittleEndian}
+
+			got, err := d.readString()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("readString() = %q, want an error", got)
+				} else if _, ok := err.(*FormatError); !ok {
+					t.Errorf("error is a %T, not a *FormatError: %v", err, err)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("readString() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The kind of type a descriptor names.
+type TypeKind int
+
+const (
+	// A descriptor which couldn't be parsed.
+	InvalidType TypeKind = iota
+	// A primitive type or void, e.g. "I".
+	PrimitiveType
+	// A class or interface, e.g. "Ljava/lang/String;".
+	ClassType
+	// An array, e.g. "[I" or "[[Ljava/lang/String;".
+	ArrayType
+)
+
+// The Java names of the primitive type descriptors.
+var primitiveNames = map[byte]string{
+	'B': "byte",
+	'C': "char",
+	'D': "double",
+	'F': "float",
+	'I': "int",
+	'J': "long",
+	'S': "short",
+	'V': "void",
+	'Z': "boolean",
+}
+
+// The prefix of the names older versions of D8 gave to the classes they
+// generated for lambdas, e.g. "-$$Lambda$Foo$abc123".
+const LegacyLambdaPrefix = "-$$Lambda$"
+
+// A parsed type descriptor. The zero value is an invalid type.
+type Type struct {
+	descriptor string
+	kind       TypeKind
+	arrayDepth int
+}
+
+// Parses a type descriptor, e.g. "I", "Ljava/lang/String;" or "[[J".
+func ParseType(descriptor string) (Type, error) {
+	t, end, err := parseTypeAt(descriptor, 0)
+	if err != nil {
+		return Type{}, err
+	}
+	if end != len(descriptor) {
+		return Type{}, fmt.Errorf("malformed type descriptor %q", descriptor)
+	}
+	return t, nil
+}
+
+// Parses the type descriptor starting at start, returning the index just past
+// it.
+func parseTypeAt(s string, start int) (Type, int, error) {
+	i := start
+	for i < len(s) && s[i] == '[' {
+		i++
+	}
+	depth := i - start
+
+	if i >= len(s) {
+		return Type{}, 0, fmt.Errorf("malformed type descriptor %q", s[start:])
+	}
+
+	end := i + 1
+	if s[i] == 'L' {
+		semi := strings.IndexByte(s[i:], ';')
+		if semi <= 1 {
+			return Type{}, 0, fmt.Errorf("malformed type descriptor %q", s[start:])
+		}
+		end = i + semi + 1
+	} else if _, ok := primitiveNames[s[i]]; !ok {
+		return Type{}, 0, fmt.Errorf("unknown type %q in descriptor %q", s[i], s[start:])
+	}
+
+	t := Type{descriptor: s[start:end], arrayDepth: depth}
+	switch {
+	case depth > 0:
+		t.kind = ArrayType
+	case s[i] == 'L':
+		t.kind = ClassType
+	default:
+		t.kind = PrimitiveType
+	}
+
+	return t, end, nil
+}
+
+// Returns the parsed type, or an invalid type holding the descriptor if it's
+// malformed.
+func TypeOf(descriptor string) Type {
+	t, err := ParseType(descriptor)
+	if err != nil {
+		return Type{descriptor: descriptor}
+	}
+	return t
+}
+
+// Returns t if it was parsed from the given descriptor, and otherwise parses the
+// descriptor.
+func parsedType(t Type, descriptor string) Type {
+	if t.descriptor == descriptor {
+		return t
+	}
+	return TypeOf(descriptor)
+}
+
+// Splits a method descriptor, e.g. "(I[Ljava/lang/String;)V", into the types
+// of its parameters and its return type.
+func ParseMethodDescriptor(descriptor string) ([]Type, Type, error) {
+	if len(descriptor) == 0 || descriptor[0] != '(' {
+		return nil, Type{}, fmt.Errorf("malformed method descriptor %q", descriptor)
+	}
+
+	params := make([]Type, 0)
+	i := 1
+	for i < len(descriptor) && descriptor[i] != ')' {
+		t, end, err := parseTypeAt(descriptor, i)
+		if err != nil {
+			return nil, Type{}, err
+		}
+
+		params = append(params, t)
+		i = end
+	}
+
+	if i >= len(descriptor) {
+		return nil, Type{}, fmt.Errorf("malformed method descriptor %q", descriptor)
+	}
+
+	ret, err := ParseType(descriptor[i+1:])
+	if err != nil {
+		return nil, Type{}, err
+	}
+
+	return params, ret, nil
+}
+
+func (t Type) Kind() TypeKind {
+	return t.kind
+}
+
+// Returns the descriptor the type was parsed from.
+func (t Type) Descriptor() string {
+	return t.descriptor
+}
+
+// Returns the number of array dimensions, e.g. 2 for "[[I", or 0 if the type
+// isn't an array.
+func (t Type) ArrayDepth() int {
+	return t.arrayDepth
+}
+
+// Returns the innermost element type of an array, e.g. "I" for "[[I". Other
+// types are their own element type.
+func (t Type) Element() Type {
+	if t.kind != ArrayType {
+		return t
+	}
+
+	elem := Type{descriptor: t.descriptor[t.arrayDepth:], kind: PrimitiveType}
+	if elem.descriptor[0] == 'L' {
+		elem.kind = ClassType
+	}
+	return elem
+}
+
+// Returns the class's binary name within its package, e.g. "Map$Entry" for
+// "Ljava/util/Map$Entry;", along with its package in internal form.
+func (t Type) className() (string, string) {
+	elem := t.Element()
+	if elem.kind != ClassType {
+		return "", ""
+	}
+
+	name := elem.descriptor[1 : len(elem.descriptor)-1]
+	slash := strings.LastIndexByte(name, '/')
+	if slash < 0 {
+		return name, ""
+	}
+	return name[slash+1:], name[:slash]
+}
+
+// Returns the dotted package of a class, or of an array's element class, e.g.
+// "java.util" for "Ljava/util/Map$Entry;". Primitives and classes in the
+// default package return "".
+func (t Type) Package() string {
+	_, pkg := t.className()
+	return strings.Replace(pkg, "/", ".", -1)
+}
+
+// Returns the chain of classes from the top-level class down to this one, e.g.
+// ["Map", "Entry"] for "Ljava/util/Map$Entry;". Arrays return the chain of
+// their element class, and primitives return nil.
+//
+// Dex files don't record nesting outside of annotations, so this splits the
+// binary name on '$'. A '$' at either end of a name, or next to another '$',
+// is taken to be part of the name, as in "Foo$$ExternalSyntheticLambda0".
+// Lambda classes named "-$$Lambda$Foo$..." by older versions of D8 are
+// top-level classes, and aren't split.
+func (t Type) Classes() []string {
+	name, _ := t.className()
+	if name == "" {
+		return nil
+	}
+	if strings.HasPrefix(name, LegacyLambdaPrefix) {
+		return []string{name}
+	}
+
+	classes := make([]string, 0, 1)
+	start := 0
+	for i := 1; i < len(name)-1; i++ {
+		if name[i] != '$' || name[i-1] == '$' || name[i+1] == '$' {
+			continue
+		}
+
+		classes = append(classes, name[start:i])
+		start = i + 1
+	}
+
+	return append(classes, name[start:])
+}
+
+// Reports whether the class is nested within another class.
+func (t Type) IsInner() bool {
+	return len(t.Classes()) > 1
+}
+
+// Returns the class that directly encloses this one, e.g. "Ljava/util/Map;"
+// for "Ljava/util/Map$Entry;". Returns false for top-level classes and for
+// types which aren't classes.
+func (t Type) Outer() (Type, bool) {
+	if t.kind != ClassType {
+		return Type{}, false
+	}
+
+	classes := t.Classes()
+	if len(classes) < 2 {
+		return Type{}, false
+	}
+
+	inner := classes[len(classes)-1]
+	end := len(t.descriptor) - 1 - len(inner) - 1
+	return Type{descriptor: t.descriptor[:end] + ";", kind: ClassType}, true
+}
+
+// Returns the name of the type as it would appear in Java source, without
+// the package or enclosing classes, e.g. "Entry" for "Ljava/util/Map$Entry;"
+// or "int[]" for "[I".
+func (t Type) SimpleName() string {
+	elem := t.Element()
+
+	var name string
+	switch elem.kind {
+	case PrimitiveType:
+		name = primitiveNames[elem.descriptor[0]]
+	case ClassType:
+		if classes := elem.Classes(); len(classes) > 0 {
+			name = classes[len(classes)-1]
+		}
+	default:
+		return t.descriptor
+	}
+
+	return name + strings.Repeat("[]", t.arrayDepth)
+}
+
+// Returns the type in dotted form, e.g. "java.util.Map$Entry" or "int[][]".
+// Invalid types return their descriptor unchanged.
+func (t Type) String() string {
+	elem := t.Element()
+
+	var name string
+	switch elem.kind {
+	case PrimitiveType:
+		name = primitiveNames[elem.descriptor[0]]
+	case ClassType:
+		name = strings.Replace(elem.descriptor[1:len(elem.descriptor)-1], "/", ".", -1)
+	default:
+		return t.descriptor
+	}
+
+	return name + strings.Repeat("[]", t.arrayDepth)
+}
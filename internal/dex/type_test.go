@@ -0,0 +1,292 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseType(t *testing.T) {
+	tests := []struct {
+		descriptor string
+		wantKind   TypeKind
+		wantDepth  int
+		wantString string
+		wantErr    bool
+	}{
+		{descriptor: "I", wantKind: PrimitiveType, wantString: "int"},
+		{descriptor: "V", wantKind: PrimitiveType, wantString: "void"},
+		{descriptor: "Ljava/lang/String;", wantKind: ClassType, wantString: "java.lang.String"},
+		{descriptor: "LFoo;", wantKind: ClassType, wantString: "Foo"},
+		{descriptor: "[J", wantKind: ArrayType, wantDepth: 1, wantString: "long[]"},
+		{descriptor: "[[Ljava/util/Map$Entry;", wantKind: ArrayType, wantDepth: 2, wantString: "java.util.Map$Entry[][]"},
+		{descriptor: "", wantErr: true},
+		{descriptor: "Q", wantErr: true},
+		{descriptor: "[", wantErr: true},
+		{descriptor: "[V[", wantErr: true},
+		{descriptor: "L;", wantErr: true},
+		{descriptor: "Ljava/lang/String", wantErr: true},
+		{descriptor: "II", wantErr: true},
+		{descriptor: "Ljava/lang/String;I", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.descriptor, func(t *testing.T) {
+			got, err := ParseType(tt.descriptor)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseType() = %v, want an error", got)
+				}
+				if typ := TypeOf(tt.descriptor); typ.Kind() != InvalidType || typ.String() != tt.descriptor {
+					t.Errorf("TypeOf() = %v of kind %d, want an invalid type", typ, typ.Kind())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Kind() != tt.wantKind {
+				t.Errorf("Kind() = %d, want %d", got.Kind(), tt.wantKind)
+			}
+			if got.ArrayDepth() != tt.wantDepth {
+				t.Errorf("ArrayDepth() = %d, want %d", got.ArrayDepth(), tt.wantDepth)
+			}
+			if got.String() != tt.wantString {
+				t.Errorf("String() = %q, want %q", got.String(), tt.wantString)
+			}
+			if got.Descriptor() != tt.descriptor {
+				t.Errorf("Descriptor() = %q, want %q", got.Descriptor(), tt.descriptor)
+			}
+		})
+	}
+}
+
+func TestParseMethodDescriptor(t *testing.T) {
+	tests := []struct {
+		descriptor string
+		wantParams []string
+		wantReturn string
+		wantErr    bool
+	}{
+		{descriptor: "()V", wantParams: []string{}, wantReturn: "V"},
+		{descriptor: "(I[Ljava/lang/String;)V", wantParams: []string{"I", "[Ljava/lang/String;"}, wantReturn: "V"},
+		{descriptor: "(JDLFoo;)[[I", wantParams: []string{"J", "D", "LFoo;"}, wantReturn: "[[I"},
+		{descriptor: "", wantErr: true},
+		{descriptor: "V", wantErr: true},
+		{descriptor: "(I", wantErr: true},
+		{descriptor: "(I)", wantErr: true},
+		{descriptor: "(L;)V", wantErr: true},
+		{descriptor: "(Q)V", wantErr: true},
+		{descriptor: "(I)VV", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.descriptor, func(t *testing.T) {
+			params, ret, err := ParseMethodDescriptor(tt.descriptor)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseMethodDescriptor() = %v, %v, want an error", params, ret)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make([]string, len(params))
+			for i, p := range params {
+				got[i] = p.Descriptor()
+			}
+			if !reflect.DeepEqual(got, tt.wantParams) {
+				t.Errorf("params = %v, want %v", got, tt.wantParams)
+			}
+			if ret.Descriptor() != tt.wantReturn {
+				t.Errorf("return = %q, want %q", ret.Descriptor(), tt.wantReturn)
+			}
+		})
+	}
+}
+
+func TestTypeNesting(t *testing.T) {
+	tests := []struct {
+		descriptor     string
+		wantClasses    []string
+		wantOuter      string
+		wantSimpleName string
+		wantPackage    string
+	}{
+		{
+			descriptor:     "Ljava/util/Map$Entry;",
+			wantClasses:    []string{"Map", "Entry"},
+			wantOuter:      "Ljava/util/Map;",
+			wantSimpleName: "Entry",
+			wantPackage:    "java.util",
+		},
+		{
+			descriptor:     "Lcom/example/A$B$C;",
+			wantClasses:    []string{"A", "B", "C"},
+			wantOuter:      "Lcom/example/A$B;",
+			wantSimpleName: "C",
+			wantPackage:    "com.example",
+		},
+		{
+			descriptor:     "LFoo;",
+			wantClasses:    []string{"Foo"},
+			wantSimpleName: "Foo",
+		},
+		{
+			descriptor:     "Lcom/example/Foo$1;",
+			wantClasses:    []string{"Foo", "1"},
+			wantOuter:      "Lcom/example/Foo;",
+			wantSimpleName: "1",
+			wantPackage:    "com.example",
+		},
+		{
+			descriptor:     "Lcom/example/Foo$$ExternalSyntheticLambda0;",
+			wantClasses:    []string{"Foo$$ExternalSyntheticLambda0"},
+			wantSimpleName: "Foo$$ExternalSyntheticLambda0",
+			wantPackage:    "com.example",
+		},
+		{
+			descriptor:     "Lcom/example/-$$Lambda$Foo$abc123;",
+			wantClasses:    []string{"-$$Lambda$Foo$abc123"},
+			wantSimpleName: "-$$Lambda$Foo$abc123",
+			wantPackage:    "com.example",
+		},
+		{
+			descriptor:     "Lcom/example/Foo$;",
+			wantClasses:    []string{"Foo$"},
+			wantSimpleName: "Foo$",
+			wantPackage:    "com.example",
+		},
+		{
+			descriptor:     "Lcom/example/Foo$Bar$;",
+			wantClasses:    []string{"Foo", "Bar$"},
+			wantOuter:      "Lcom/example/Foo;",
+			wantSimpleName: "Bar$",
+			wantPackage:    "com.example",
+		},
+		{
+			descriptor:     "L$Foo;",
+			wantClasses:    []string{"$Foo"},
+			wantSimpleName: "$Foo",
+		},
+		{
+			// Arrays take the classes of their element, but aren't nested.
+			descriptor:     "[[Ljava/util/Map$Entry;",
+			wantClasses:    []string{"Map", "Entry"},
+			wantSimpleName: "Entry[][]",
+			wantPackage:    "java.util",
+		},
+		{
+			descriptor:     "I",
+			wantSimpleName: "int",
+		},
+		{
+			descriptor:     "[Z",
+			wantSimpleName: "boolean[]",
+		},
+		{
+			descriptor:     "Ljava/lang/String",
+			wantSimpleName: "Ljava/lang/String",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.descriptor, func(t *testing.T) {
+			typ := TypeOf(tt.descriptor)
+
+			if got := typ.Classes(); !reflect.DeepEqual(got, tt.wantClasses) {
+				t.Errorf("Classes() = %q, want %q", got, tt.wantClasses)
+			}
+
+			outer, ok := typ.Outer()
+			if ok != (tt.wantOuter != "") || outer.Descriptor() != tt.wantOuter {
+				t.Errorf("Outer() = %q, %t, want %q", outer.Descriptor(), ok, tt.wantOuter)
+			}
+			if ok && outer.Kind() != ClassType {
+				t.Errorf("Outer() has kind %d, want a class", outer.Kind())
+			}
+			if got := typ.IsInner(); got != (len(tt.wantClasses) > 1) {
+				t.Errorf("IsInner() = %t", got)
+			}
+
+			if got := typ.SimpleName(); got != tt.wantSimpleName {
+				t.Errorf("SimpleName() = %q, want %q", got, tt.wantSimpleName)
+			}
+			if got := typ.Package(); got != tt.wantPackage {
+				t.Errorf("Package() = %q, want %q", got, tt.wantPackage)
+			}
+		})
+	}
+}
+
+// References read from a DEX file carry their parsed types, which must match
+// what parsing the descriptors gives, and must be dropped once a descriptor is
+// changed.
+func TestRefTypes(t *testing.T) {
+	d, err := Parse(readFixture(t, "app.dex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, m := range d.GetMethodRefs() {
+		if got, want := m.Class(), TypeOf(m.DeclClass); got != want {
+			t.Errorf("%s: Class() = %+v, want %+v", m.JavaSignature(), got, want)
+		}
+		if got, want := m.Return(), TypeOf(m.ReturnType); got != want {
+			t.Errorf("%s: Return() = %+v, want %+v", m.JavaSignature(), got, want)
+		}
+		for i, param := range m.Params() {
+			if want := TypeOf(m.ArgTypes[i]); param != want {
+				t.Errorf("%s: Params()[%d] = %+v, want %+v", m.JavaSignature(), i, param, want)
+			}
+		}
+	}
+	for _, f := range d.GetFieldRefs() {
+		if got, want := f.Class(), TypeOf(f.DeclClass); got != want {
+			t.Errorf("%s.%s: Class() = %+v, want %+v", f.DeclClass, f.FieldName, got, want)
+		}
+		if got, want := f.Type(), TypeOf(f.FieldType); got != want {
+			t.Errorf("%s.%s: Type() = %+v, want %+v", f.DeclClass, f.FieldName, got, want)
+		}
+	}
+
+	m := d.GetMethodRefs()[0]
+	m.DeclClass = "Lcom/example/Renamed;"
+	m.ArgTypes = []string{"[I"}
+	m.ReturnType = "J"
+	if got, want := m.JavaSignature(), "com.example.Renamed."+m.MethodName+"(int[])"; got != want {
+		t.Errorf("JavaSignature() after renaming = %q, want %q", got, want)
+	}
+	if got := m.Return().String(); got != "long" {
+		t.Errorf("Return() after renaming = %q, want long", got)
+	}
+
+	f := d.GetFieldRefs()[0]
+	f.DeclClass = "Lcom/example/Renamed;"
+	f.FieldType = "Z"
+	if got := f.Class().String(); got != "com.example.Renamed" {
+		t.Errorf("Class() after renaming = %q", got)
+	}
+	if got := f.Type().String(); got != "boolean" {
+		t.Errorf("Type() after renaming = %q", got)
+	}
+}
@@ -0,0 +1,116 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/adler32"
+	"strings"
+)
+
+// Offsets of the checksum, signature and file_size in the header. The checksum
+// and signature each cover the bytes which follow them, up to file_size.
+const (
+	checksumOff  = 8
+	signatureOff = checksumOff + 4
+	signatureEnd = signatureOff + sha1.Size
+	fileSizeOff  = signatureEnd
+)
+
+// The checksum, signature and file size recorded in a DEX file's header, along
+// with the values computed from its contents.
+type Verification struct {
+	Checksum         uint32
+	ComputedChecksum uint32
+
+	Signature         [sha1.Size]byte
+	ComputedSignature [sha1.Size]byte
+
+	// The file_size in the header, and the size of the buffer the file was
+	// parsed from.
+	FileSize int
+	Size     int
+}
+
+// Reports whether the Adler-32 checksum in the header matches the file.
+func (v Verification) ChecksumValid() bool {
+	return v.Checksum == v.ComputedChecksum
+}
+
+// Reports whether the SHA-1 signature in the header matches the file.
+func (v Verification) SignatureValid() bool {
+	return v.Signature == v.ComputedSignature
+}
+
+// Reports whether the file_size in the header matches the size of the file.
+func (v Verification) SizeValid() bool {
+	return v.FileSize == v.Size
+}
+
+// Returns nil if the checksum, signature and file size all match, or an error
+// describing each mismatch.
+func (v Verification) Err() error {
+	var msgs []string
+	if !v.ChecksumValid() {
+		msgs = append(msgs, fmt.Sprintf("checksum is %08x, but the contents give %08x", v.Checksum, v.ComputedChecksum))
+	}
+	if !v.SignatureValid() {
+		msgs = append(msgs, fmt.Sprintf("signature is %s, but the contents give %s",
+			hex.EncodeToString(v.Signature[:]), hex.EncodeToString(v.ComputedSignature[:])))
+	}
+	if !v.SizeValid() {
+		msgs = append(msgs, fmt.Sprintf("file_size is %d, but the file is %d bytes", v.FileSize, v.Size))
+	}
+
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	offset := checksumOff
+	if v.ChecksumValid() && v.SignatureValid() {
+		offset = fileSizeOff
+	} else if v.ChecksumValid() {
+		offset = signatureOff
+	}
+	return &FormatError{Section: "header_item", Offset: offset, Index: -1, Err: errors.New(strings.Join(msgs, "; "))}
+}
+
+// Computes the checksum and signature of the file and compares them to the
+// values in its header. Both are computed up to the file_size in the header, so
+// that bytes after the end of the file are only reported as a size mismatch.
+// If file_size is past the end of the buffer, they run to the end of it.
+func (d *Data) Verify() Verification {
+	end := d.headerItem.fileSize
+	if end < signatureEnd || end > len(d.buf) {
+		end = len(d.buf)
+	}
+
+	v := Verification{
+		Checksum:          d.order.Uint32(d.buf[checksumOff:]),
+		ComputedChecksum:  adler32.Checksum(d.buf[signatureOff:end]),
+		ComputedSignature: sha1.Sum(d.buf[signatureEnd:end]),
+		FileSize:          d.headerItem.fileSize,
+		Size:              len(d.buf),
+	}
+	copy(v.Signature[:], d.buf[signatureOff:signatureEnd])
+
+	return v
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/adler32"
+	"testing"
+)
+
+func TestVerify(t *testing.T) {
+	tests := []struct {
+		name string
+		// Changes a copy of app.dex.
+		modify                                func([]byte) []byte
+		wantChecksum, wantSignature, wantSize bool
+	}{
+		{
+			name:          "good",
+			modify:        func(buf []byte) []byte { return buf },
+			wantChecksum:  true,
+			wantSignature: true,
+			wantSize:      true,
+		},
+		{
+			name: "bad checksum",
+			modify: func(buf []byte) []byte {
+				buf[checksumOff]++
+				return buf
+			},
+			wantSignature: true,
+			wantSize:      true,
+		},
+		{
+			// The checksum covers the signature, so it's recomputed.
+			name: "bad signature",
+			modify: func(buf []byte) []byte {
+				buf[signatureOff]++
+				binary.LittleEndian.PutUint32(buf[checksumOff:], adler32.Checksum(buf[signatureOff:]))
+				return buf
+			},
+			wantChecksum: true,
+			wantSize:     true,
+		},
+		{
+			name: "bad contents",
+			modify: func(buf []byte) []byte {
+				buf[bytes.Index(buf, []byte("onCreate"))]++
+				return buf
+			},
+			wantSize: true,
+		},
+		{
+			// Bytes after file_size aren't covered by the checksum or
+			// signature.
+			name: "trailing bytes",
+			modify: func(buf []byte) []byte {
+				return append(buf, 0, 0, 0, 0)
+			},
+			wantChecksum:  true,
+			wantSignature: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := tt.modify(readFixture(t, "app.dex"))
+			d, err := Parse(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			v := d.Verify()
+			if v.ChecksumValid() != tt.wantChecksum {
+				t.Errorf("ChecksumValid() = %t, want %t", v.ChecksumValid(), tt.wantChecksum)
+			}
+			if v.SignatureValid() != tt.wantSignature {
+				t.Errorf("SignatureValid() = %t, want %t", v.SignatureValid(), tt.wantSignature)
+			}
+			if v.SizeValid() != tt.wantSize {
+				t.Errorf("SizeValid() = %t, want %t", v.SizeValid(), tt.wantSize)
+			}
+
+			wantErr := !tt.wantChecksum || !tt.wantSignature || !tt.wantSize
+			err = v.Err()
+			if (err != nil) != wantErr {
+				t.Errorf("Err() = %v, want an error: %t", err, wantErr)
+			}
+			if _, ok := err.(*FormatError); err != nil && !ok {
+				t.Errorf("error is a %T, not a *FormatError: %v", err, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package input
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"strings"
+
+	"github.com/rsookram/dex-method-counts/internal/classfile"
+)
+
+// Tries to open an input file as a jar of class files, or an aar with a
+// classes.jar and libs/*.jar inside. Returns nil if the input isn't one, or if
+// it also contains dex files, in which case those are counted instead.
+func OpenClassFiles(fileName string) (*classfile.Classes, error) {
+	reader, err := zip.OpenReader(fileName)
+	if err != nil {
+		// Probably not a zip
+		return nil, nil
+	}
+	defer reader.Close()
+
+	bundle := isBundle(reader.File)
+	for _, file := range reader.File {
+		if _, ok := dexEntry(file.Name, bundle); ok {
+			return nil, nil
+		}
+	}
+
+	classes := &classfile.Classes{}
+	if err := addClassFiles(classes, reader.File); err != nil {
+		return nil, err
+	}
+
+	if classes.Len() == 0 {
+		return nil, nil
+	}
+
+	return classes, nil
+}
+
+// Adds every class file in the given zip entries, descending into the jars
+// that an aar holds.
+func addClassFiles(classes *classfile.Classes, files []*zip.File) error {
+	for _, file := range files {
+		name := file.Name
+
+		if strings.HasSuffix(name, ".class") && !isModuleInfo(name) && !isVersioned(name) {
+			if err := addClassFile(classes, file); err != nil {
+				return err
+			}
+		} else if isAarJar(name) {
+			if err := addNestedJar(classes, file); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func addClassFile(classes *classfile.Classes, file *zip.File) error {
+	r, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	class, err := classfile.Parse(r)
+	if err != nil {
+		return err
+	}
+
+	classes.Add(class)
+	return nil
+}
+
+func addNestedJar(classes *classfile.Classes, file *zip.File) error {
+	r, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	contents, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	jar, err := zip.NewReader(bytes.NewReader(contents), int64(len(contents)))
+	if err != nil {
+		return err
+	}
+
+	return addClassFiles(classes, jar.File)
+}
+
+// Checks whether a zip entry is one of the jars in an aar.
+func isAarJar(name string) bool {
+	if name == "classes.jar" {
+		return true
+	}
+	return strings.HasPrefix(name, "libs/") && strings.HasSuffix(name, ".jar") && strings.Count(name, "/") == 1
+}
+
+// module-info.class describes a module rather than a class, and has no members
+// to count.
+func isModuleInfo(name string) bool {
+	return name == "module-info.class"
+}
+
+// A multi-release jar holds copies of some classes under
+// META-INF/versions/<N>/ for newer JVMs. Only the base version of each class
+// is counted, as only one of them is loaded.
+func isVersioned(name string) bool {
+	return strings.HasPrefix(name, "META-INF/versions/")
+}
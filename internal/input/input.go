@@ -0,0 +1,171 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright Mihai Parparita
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package input reads the files given to the tool: dex files, and the APKs,
+// app bundles, jars and aars which hold them.
+package input
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+)
+
+// Returned for a jar or aar of class files, which don't hold any dex files.
+var ErrClassFiles = errors.New("holds class files rather than dex files")
+
+// A dex file read from an input, along with the name it had in the input.
+type DexFile struct {
+	// The name of the file, e.g. "classes2.dex" for an entry in an APK.
+	Name string
+	// The module the file belongs to when the input is an app bundle, e.g.
+	// "base". Empty for other inputs.
+	Module string
+	Data   []byte
+}
+
+// Checks whether a zip entry is a top-level dex file, as found in an APK.
+func IsClassesDex(name string) bool {
+	return strings.HasPrefix(name, "classes") && strings.HasSuffix(name, ".dex")
+}
+
+// Checks whether a zip entry is a dex file within an app bundle module, i.e.
+// "<module>/dex/classes*.dex", and returns the name of the module if so.
+func BundleModule(name string) (string, bool) {
+	parts := strings.Split(name, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] != "dex" || !IsClassesDex(parts[2]) {
+		return "", false
+	}
+
+	return parts[0], true
+}
+
+// Checks whether the entries of a zip are those of an app bundle rather than
+// an APK or jar. Every bundle has a BundleConfig.pb and a base module with a
+// manifest, and an APK could happen to have "<dir>/dex/classes.dex" entries,
+// e.g. in its assets.
+func isBundle(files []*zip.File) bool {
+	for _, file := range files {
+		if file.Name == "BundleConfig.pb" || file.Name == "base/manifest/AndroidManifest.xml" {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks whether a zip entry is a dex file to be counted, and returns the
+// module it belongs to if the zip is an app bundle.
+func dexEntry(name string, bundle bool) (string, bool) {
+	if bundle {
+		return BundleModule(name)
+	}
+	return "", IsClassesDex(name)
+}
+
+// Parses each dex file in the given input and passes it to fn, in the order
+// they appear in the input. Stops at the first error fn returns.
+func ForEachDex(fileName string, fn func(f DexFile, d *dex.Data) error) error {
+	dexFiles, err := OpenDexFiles(fileName)
+	if err != nil {
+		return fmt.Errorf("Failed to open dex files. %w", err)
+	}
+
+	for _, dexFile := range dexFiles {
+		data, err := dex.Parse(dexFile.Data)
+		if err != nil {
+			return fmt.Errorf("Failed to load dex file. %w", err)
+		}
+
+		if err := fn(dexFile, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reads an input file, which could be a .dex, a .jar/.apk with a classes.dex
+// inside, or an .aab with a dex directory in each module. Zip entries are
+// decompressed into memory. Returns an error wrapping ErrClassFiles for jars
+// and aars which haven't been dexed.
+func OpenDexFiles(fileName string) ([]DexFile, error) {
+	dexFiles, err := openInputFileAsZip(fileName)
+	if err != nil {
+		return []DexFile{}, err
+	}
+
+	if len(dexFiles) == 0 {
+		data, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			return []DexFile{}, err
+		}
+
+		return []DexFile{{Name: filepath.Base(fileName), Data: data}}, nil
+	}
+
+	return dexFiles, err
+}
+
+// Tries to open an input file as a Zip archive (jar/apk) with a "classes.dex"
+// inside, or an app bundle (aab) with "<module>/dex/classes.dex" entries.
+func openInputFileAsZip(fileName string) ([]DexFile, error) {
+	reader, err := zip.OpenReader(fileName)
+	if err != nil {
+		// Probably not a zip
+		return []DexFile{}, nil
+	}
+	defer reader.Close()
+
+	bundle := isBundle(reader.File)
+
+	dexFiles := make([]DexFile, 0)
+	classFiles := false
+	for _, file := range reader.File {
+		name := file.Name
+		if module, ok := dexEntry(name, bundle); ok {
+			data, err := readZipEntry(file)
+			if err != nil {
+				return []DexFile{}, err
+			}
+
+			dexFiles = append(dexFiles, DexFile{Name: name, Module: module, Data: data})
+		} else if strings.HasSuffix(name, ".class") || isAarJar(name) {
+			classFiles = true
+		}
+	}
+
+	if len(dexFiles) == 0 && classFiles {
+		return []DexFile{}, fmt.Errorf("%s %w", filepath.Base(fileName), ErrClassFiles)
+	}
+
+	return dexFiles, nil
+}
+
+func readZipEntry(zf *zip.File) ([]byte, error) {
+	fileReader, err := zf.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer fileReader.Close()
+
+	return ioutil.ReadAll(fileReader)
+}
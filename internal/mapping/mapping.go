@@ -0,0 +1,320 @@
+/*
+Copyright 2017 Rashad Sookram
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mapping reads the mapping.txt files written by R8 and ProGuard, and
+// uses them to restore the original names of obfuscated references.
+package mapping
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+)
+
+// The contents of a mapping file. All classes are keyed by their obfuscated
+// type descriptor, e.g. "La/b/c;".
+//
+// A nil *Mapping is valid, and leaves everything unchanged.
+type Mapping struct {
+	classes map[string]*classMapping
+}
+
+type classMapping struct {
+	// The original type descriptor, e.g. "Lcom/example/Foo;".
+	original string
+	fields   []memberMapping
+	methods  []memberMapping
+}
+
+type memberMapping struct {
+	obfuscatedName string
+	originalName   string
+	// For fields, the original type descriptor of the field. For methods, the
+	// original descriptors of the arguments joined together.
+	originalType string
+}
+
+// Reads the mapping file at the given path.
+func Open(path string) (*Mapping, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Parses a mapping file. Each class is described by a line of the form
+//
+//	com.example.Foo -> a.b:
+//
+// followed by lines for its members, each indented with whitespace
+//
+//	int count -> a
+//	1:4:void bar(int,java.lang.String):10:13 -> b
+//
+// Lines starting with '#' are comments.
+func Parse(r io.Reader) (*Mapping, error) {
+	m := &Mapping{classes: make(map[string]*classMapping)}
+
+	var current *classMapping
+	// The line number range and obfuscated name of the last method, used to
+	// detect runs of inlined frames.
+	lastMethodKey := ""
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		arrow := strings.Index(trimmed, " -> ")
+		if arrow < 0 {
+			return nil, fmt.Errorf("mapping line %d: missing ' -> '", lineNum)
+		}
+		left := trimmed[:arrow]
+		right := trimmed[arrow+len(" -> "):]
+
+		if line[0] != ' ' && line[0] != '\t' {
+			if !strings.HasSuffix(right, ":") {
+				return nil, fmt.Errorf("mapping line %d: class mapping must end with ':'", lineNum)
+			}
+
+			obfuscated := javaNameToDescriptor(strings.TrimSuffix(right, ":"))
+			current = &classMapping{original: javaNameToDescriptor(left)}
+			m.classes[obfuscated] = current
+			lastMethodKey = ""
+			continue
+		}
+
+		if current == nil {
+			return nil, fmt.Errorf("mapping line %d: member outside of a class", lineNum)
+		}
+
+		if !strings.Contains(left, "(") {
+			member, err := parseField(left, right)
+			if err != nil {
+				return nil, fmt.Errorf("mapping line %d: %v", lineNum, err)
+			}
+			current.fields = append(current.fields, member)
+			continue
+		}
+
+		lineRange, member, err := parseMethod(left, right)
+		if err != nil {
+			return nil, fmt.Errorf("mapping line %d: %v", lineNum, err)
+		}
+
+		// Inlined methods are listed before the method they were inlined into,
+		// all sharing the same line number range and obfuscated name. Only the
+		// last one in the run is the method which exists in the dex.
+		key := lineRange + " " + member.obfuscatedName
+		if lineRange != "" && key == lastMethodKey {
+			current.methods[len(current.methods)-1] = member
+		} else {
+			current.methods = append(current.methods, member)
+		}
+		lastMethodKey = key
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Parses the two halves of a field line, e.g. "int count" and "a".
+func parseField(left, right string) (memberMapping, error) {
+	parts := strings.Fields(left)
+	if len(parts) != 2 {
+		return memberMapping{}, fmt.Errorf("malformed field %q", left)
+	}
+
+	return memberMapping{
+		obfuscatedName: right,
+		originalName:   parts[1],
+		originalType:   javaNameToDescriptor(parts[0]),
+	}, nil
+}
+
+// Parses the two halves of a method line, e.g. "1:4:void bar(int):10:13" and
+// "b". Returns the leading line number range, which may be empty, along with
+// the method.
+func parseMethod(left, right string) (string, memberMapping, error) {
+	openParen := strings.IndexByte(left, '(')
+	closeParen := strings.LastIndexByte(left, ')')
+	if closeParen < openParen {
+		return "", memberMapping{}, fmt.Errorf("malformed method %q", left)
+	}
+
+	// Strip the leading "start:end:" range, if any.
+	head := left[:openParen]
+	lineRange := ""
+	if colon := strings.LastIndexByte(head, ':'); colon >= 0 {
+		lineRange = head[:colon]
+		head = head[colon+1:]
+	}
+
+	parts := strings.Fields(head)
+	if len(parts) != 2 {
+		return "", memberMapping{}, fmt.Errorf("malformed method %q", left)
+	}
+
+	args := ""
+	if argList := left[openParen+1 : closeParen]; argList != "" {
+		for _, arg := range strings.Split(argList, ",") {
+			args += javaNameToDescriptor(strings.TrimSpace(arg))
+		}
+	}
+
+	return lineRange, memberMapping{
+		obfuscatedName: right,
+		originalName:   parts[1],
+		originalType:   args,
+	}, nil
+}
+
+// Converts a Java type name, as used in mapping files, to a type descriptor.
+// For example, "java.lang.String[]" becomes "[Ljava/lang/String;".
+func javaNameToDescriptor(name string) string {
+	prefix := ""
+	for strings.HasSuffix(name, "[]") {
+		prefix += "["
+		name = strings.TrimSuffix(name, "[]")
+	}
+
+	switch name {
+	case "boolean":
+		return prefix + "Z"
+	case "byte":
+		return prefix + "B"
+	case "char":
+		return prefix + "C"
+	case "double":
+		return prefix + "D"
+	case "float":
+		return prefix + "F"
+	case "int":
+		return prefix + "I"
+	case "long":
+		return prefix + "J"
+	case "short":
+		return prefix + "S"
+	case "void":
+		return prefix + "V"
+	default:
+		return prefix + "L" + strings.Replace(name, ".", "/", -1) + ";"
+	}
+}
+
+// Returns the original form of a type descriptor, which may be an array.
+// Descriptors which aren't in the mapping are returned unchanged.
+func (m *Mapping) Type(descriptor string) string {
+	if m == nil {
+		return descriptor
+	}
+
+	element := strings.TrimLeft(descriptor, "[")
+	class, ok := m.classes[element]
+	if !ok {
+		return descriptor
+	}
+
+	return descriptor[:len(descriptor)-len(element)] + class.original
+}
+
+// Returns the method reference with its declaring class, name and types
+// restored to their original values.
+func (m *Mapping) MethodRef(ref dex.MethodRef) dex.MethodRef {
+	if m == nil {
+		return ref
+	}
+
+	original := dex.MethodRef{
+		DeclClass:  m.Type(ref.DeclClass),
+		ArgTypes:   make([]string, len(ref.ArgTypes)),
+		ReturnType: m.Type(ref.ReturnType),
+		MethodName: ref.MethodName,
+	}
+	for i, arg := range ref.ArgTypes {
+		original.ArgTypes[i] = m.Type(arg)
+	}
+
+	if class, ok := m.classes[ref.DeclClass]; ok {
+		original.MethodName = lookupMember(class.methods, ref.MethodName, strings.Join(original.ArgTypes, ""))
+	}
+
+	return original
+}
+
+// Returns the field reference with its declaring class, name and type
+// restored to their original values.
+func (m *Mapping) FieldRef(ref dex.FieldRef) dex.FieldRef {
+	if m == nil {
+		return ref
+	}
+
+	original := dex.FieldRef{
+		DeclClass: m.Type(ref.DeclClass),
+		FieldType: m.Type(ref.FieldType),
+		FieldName: ref.FieldName,
+	}
+
+	if class, ok := m.classes[ref.DeclClass]; ok {
+		original.FieldName = lookupMember(class.fields, ref.FieldName, original.FieldType)
+	}
+
+	return original
+}
+
+// Finds the original name of a member given its obfuscated name and original
+// type. Since obfuscated names are overloaded, the type is used to pick
+// between members sharing a name. If there's no exact match, but the name is
+// unambiguous, that name is used.
+func lookupMember(members []memberMapping, obfuscatedName, originalType string) string {
+	candidate := ""
+	candidates := 0
+
+	for _, member := range members {
+		if member.obfuscatedName != obfuscatedName {
+			continue
+		}
+		if member.originalType == originalType {
+			return member.originalName
+		}
+		if member.originalName != candidate {
+			candidate = member.originalName
+			candidates++
+		}
+	}
+
+	if candidates == 1 {
+		return candidate
+	}
+
+	return obfuscatedName
+}
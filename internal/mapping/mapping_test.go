@@ -0,0 +1,213 @@
+/*
+Copyright 2017 Rashad Sookram
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mapping
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/rsookram/dex-method-counts/internal/dex"
+)
+
+// A mapping in the form R8 writes, with a run of inlined frames and methods
+// overloaded on their obfuscated name.
+const sample = `# compiler: R8
+# {"id":"com.android.tools.r8.mapping","version":"2.0"}
+com.example.Foo -> a.a:
+    int count -> a
+    long[][] values -> b
+    com.example.Foo next -> c
+    1:1:void start(int):12:12 -> d
+    2:3:void stop(java.lang.String[]):20:21 -> d
+    1:1:java.lang.String com.example.Util.format(int):40:40 -> e
+    1:1:void run():10 -> e
+    void take(com.example.Foo,boolean) -> f
+com.example.Foo$Inner -> a.b:
+    void <init>() -> <init>
+`
+
+func parseSample(t *testing.T) *Mapping {
+	t.Helper()
+
+	m, err := Parse(strings.NewReader(sample))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestType(t *testing.T) {
+	m := parseSample(t)
+
+	tests := []struct {
+		descriptor string
+		want       string
+	}{
+		{"La/a;", "Lcom/example/Foo;"},
+		{"La/b;", "Lcom/example/Foo$Inner;"},
+		{"[[La/a;", "[[Lcom/example/Foo;"},
+		{"Ljava/lang/String;", "Ljava/lang/String;"},
+		{"I", "I"},
+		{"[J", "[J"},
+	}
+
+	for _, tt := range tests {
+		if got := m.Type(tt.descriptor); got != tt.want {
+			t.Errorf("Type(%q) = %q, want %q", tt.descriptor, got, tt.want)
+		}
+	}
+}
+
+func TestFieldRef(t *testing.T) {
+	m := parseSample(t)
+
+	tests := []struct {
+		ref  dex.FieldRef
+		want dex.FieldRef
+	}{
+		{
+			ref:  dex.FieldRef{DeclClass: "La/a;", FieldType: "I", FieldName: "a"},
+			want: dex.FieldRef{DeclClass: "Lcom/example/Foo;", FieldType: "I", FieldName: "count"},
+		},
+		{
+			ref:  dex.FieldRef{DeclClass: "La/a;", FieldType: "[[J", FieldName: "b"},
+			want: dex.FieldRef{DeclClass: "Lcom/example/Foo;", FieldType: "[[J", FieldName: "values"},
+		},
+		{
+			ref:  dex.FieldRef{DeclClass: "La/a;", FieldType: "La/a;", FieldName: "c"},
+			want: dex.FieldRef{DeclClass: "Lcom/example/Foo;", FieldType: "Lcom/example/Foo;", FieldName: "next"},
+		},
+		// A member which isn't in the mapping keeps its name.
+		{
+			ref:  dex.FieldRef{DeclClass: "La/a;", FieldType: "I", FieldName: "z"},
+			want: dex.FieldRef{DeclClass: "Lcom/example/Foo;", FieldType: "I", FieldName: "z"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := m.FieldRef(tt.ref); got != tt.want {
+			t.Errorf("FieldRef(%+v) = %+v, want %+v", tt.ref, got, tt.want)
+		}
+	}
+}
+
+func TestMethodRef(t *testing.T) {
+	m := parseSample(t)
+
+	tests := []struct {
+		name string
+		ref  dex.MethodRef
+		want dex.MethodRef
+	}{
+		{
+			name: "overload by int",
+			ref:  dex.MethodRef{DeclClass: "La/a;", MethodName: "d", ArgTypes: []string{"I"}, ReturnType: "V"},
+			want: dex.MethodRef{DeclClass: "Lcom/example/Foo;", MethodName: "start", ArgTypes: []string{"I"}, ReturnType: "V"},
+		},
+		{
+			name: "overload by array",
+			ref:  dex.MethodRef{DeclClass: "La/a;", MethodName: "d", ArgTypes: []string{"[Ljava/lang/String;"}, ReturnType: "V"},
+			want: dex.MethodRef{DeclClass: "Lcom/example/Foo;", MethodName: "stop", ArgTypes: []string{"[Ljava/lang/String;"}, ReturnType: "V"},
+		},
+		{
+			// Neither overload matches, so the name stays obfuscated.
+			name: "ambiguous",
+			ref:  dex.MethodRef{DeclClass: "La/a;", MethodName: "d", ArgTypes: []string{"J"}, ReturnType: "V"},
+			want: dex.MethodRef{DeclClass: "Lcom/example/Foo;", MethodName: "d", ArgTypes: []string{"J"}, ReturnType: "V"},
+		},
+		{
+			// format was inlined into run, which is the method in the dex.
+			name: "inlined frames",
+			ref:  dex.MethodRef{DeclClass: "La/a;", MethodName: "e", ReturnType: "V"},
+			want: dex.MethodRef{DeclClass: "Lcom/example/Foo;", MethodName: "run", ArgTypes: []string{}, ReturnType: "V"},
+		},
+		{
+			name: "renamed types",
+			ref:  dex.MethodRef{DeclClass: "La/a;", MethodName: "f", ArgTypes: []string{"La/a;", "Z"}, ReturnType: "La/b;"},
+			want: dex.MethodRef{DeclClass: "Lcom/example/Foo;", MethodName: "take", ArgTypes: []string{"Lcom/example/Foo;", "Z"}, ReturnType: "Lcom/example/Foo$Inner;"},
+		},
+		{
+			name: "unmapped class",
+			ref:  dex.MethodRef{DeclClass: "Ljava/lang/Object;", MethodName: "d", ArgTypes: []string{"La/a;"}, ReturnType: "V"},
+			want: dex.MethodRef{DeclClass: "Ljava/lang/Object;", MethodName: "d", ArgTypes: []string{"Lcom/example/Foo;"}, ReturnType: "V"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := m.MethodRef(tt.ref); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MethodRef() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNilMapping(t *testing.T) {
+	var m *Mapping
+
+	ref := dex.MethodRef{DeclClass: "La/a;", MethodName: "d", ArgTypes: []string{"I"}, ReturnType: "V"}
+	if got := m.MethodRef(ref); !reflect.DeepEqual(got, ref) {
+		t.Errorf("MethodRef() = %+v, want %+v", got, ref)
+	}
+	if got := m.Type("La/a;"); got != "La/a;" {
+		t.Errorf("Type() = %q, want it unchanged", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping string
+		want    string
+	}{
+		{
+			name:    "missing arrow",
+			mapping: "com.example.Foo -> a.a:\n    int count a\n",
+			want:    "mapping line 2: missing ' -> '",
+		},
+		{
+			name:    "class without colon",
+			mapping: "com.example.Foo -> a.a\n",
+			want:    "mapping line 1: class mapping must end with ':'",
+		},
+		{
+			name:    "member outside of a class",
+			mapping: "# header\n    int count -> a\n",
+			want:    "mapping line 2: member outside of a class",
+		},
+		{
+			name:    "malformed field",
+			mapping: "com.example.Foo -> a.a:\n    count -> a\n",
+			want:    `mapping line 2: malformed field "count"`,
+		},
+		{
+			name:    "malformed method",
+			mapping: "com.example.Foo -> a.a:\n    void run)( -> a\n",
+			want:    `mapping line 2: malformed method "void run)("`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tt.mapping))
+			if err == nil || err.Error() != tt.want {
+				t.Errorf("Parse() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package mutf8 converts between Go strings and the Modified UTF-8 encoding
+// which DEX and JVM class files use for their strings.
+//
+// Modified UTF-8 differs from UTF-8 in two ways. U+0000 is encoded as the two
+// bytes C0 80, so that encoded strings never contain a NUL byte. Supplementary
+// characters are encoded as a UTF-16 surrogate pair, with each half taking
+// three bytes.
+package mutf8
+
+import (
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Decodes a Modified UTF-8 string. Surrogates which aren't part of a pair are
+// kept as the three bytes which encode them, as in WTF-8. The string isn't
+// valid UTF-8 then, but distinct inputs always decode to distinct strings,
+// which Encode turns back into the same bytes. Returns an error for a NUL
+// byte, which Modified UTF-8 never contains, and for malformed or truncated
+// sequences.
+func Decode(b []byte) (string, error) {
+	units := make([]uint16, 0, len(b))
+
+	for i := 0; i < len(b); {
+		c := b[i]
+
+		switch {
+		case c == 0:
+			return "", fmt.Errorf("NUL byte at %d", i)
+		case c < 0x80:
+			units = append(units, uint16(c))
+			i++
+		case c&0xe0 == 0xc0:
+			if i+1 >= len(b) || b[i+1]&0xc0 != 0x80 {
+				return "", fmt.Errorf("truncated two byte sequence at %d", i)
+			}
+			units = append(units, uint16(c&0x1f)<<6|uint16(b[i+1]&0x3f))
+			i += 2
+		case c&0xf0 == 0xe0:
+			if i+2 >= len(b) || b[i+1]&0xc0 != 0x80 || b[i+2]&0xc0 != 0x80 {
+				return "", fmt.Errorf("truncated three byte sequence at %d", i)
+			}
+			units = append(units, uint16(c&0x0f)<<12|uint16(b[i+1]&0x3f)<<6|uint16(b[i+2]&0x3f))
+			i += 3
+		default:
+			return "", fmt.Errorf("invalid byte %#x at %d", c, i)
+		}
+	}
+
+	s := make([]byte, 0, len(b))
+	for i := 0; i < len(units); i++ {
+		unit := units[i]
+
+		switch {
+		case utf16.IsSurrogate(rune(unit)) && i+1 < len(units):
+			if r := utf16.DecodeRune(rune(unit), rune(units[i+1])); r != utf8.RuneError {
+				s = utf8.AppendRune(s, r)
+				i++
+				continue
+			}
+			s = appendThreeBytes(s, unit)
+		case utf16.IsSurrogate(rune(unit)):
+			s = appendThreeBytes(s, unit)
+		default:
+			s = utf8.AppendRune(s, rune(unit))
+		}
+	}
+
+	return string(s), nil
+}
+
+// Encodes a string in Modified UTF-8, the inverse of Decode. Invalid UTF-8 in
+// s is encoded as U+FFFD, other than the lone surrogates which Decode keeps.
+func Encode(s string) []byte {
+	b := make([]byte, 0, len(s))
+
+	for i := 0; i < len(s); {
+		if isLoneSurrogate(s, i) {
+			b = append(b, s[i:i+3]...)
+			i += 3
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+
+		for _, unit := range utf16.Encode([]rune{r}) {
+			switch {
+			case unit != 0 && unit < 0x80:
+				b = append(b, byte(unit))
+			case unit < 0x800:
+				b = append(b, 0xc0|byte(unit>>6), 0x80|byte(unit&0x3f))
+			default:
+				b = appendThreeBytes(b, unit)
+			}
+		}
+	}
+
+	return b
+}
+
+// Returns the length of s in UTF-16 code units, which is how the length of a
+// string is given in a DEX file's string_data_item.
+func UTF16Len(s string) int {
+	n := 0
+	for i := 0; i < len(s); {
+		if isLoneSurrogate(s, i) {
+			n++
+			i += 3
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r >= 0x10000 {
+			n += 2
+		} else {
+			n++
+		}
+		i += size
+	}
+	return n
+}
+
+func appendThreeBytes(b []byte, unit uint16) []byte {
+	return append(b, 0xe0|byte(unit>>12), 0x80|byte(unit>>6&0x3f), 0x80|byte(unit&0x3f))
+}
+
+// Reports whether s holds the three byte encoding of a surrogate at i, which
+// UTF-8 doesn't allow, but Decode produces for lone surrogates.
+func isLoneSurrogate(s string, i int) bool {
+	return i+2 < len(s) && s[i] == 0xed && s[i+1] >= 0xa0 && s[i+1] <= 0xbf && s[i+2]&0xc0 == 0x80
+}
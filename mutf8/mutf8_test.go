@@ -0,0 +1,123 @@
+/*
+Copyright 2017 Rashad Sookram
+Copyright (C) 2009 The Android Open Source Project
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package mutf8
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		s        string
+		encoded  []byte
+		utf16Len int
+	}{
+		{"empty", "", []byte{}, 0},
+		{"ASCII", "Lcom/example/Foo;", []byte("Lcom/example/Foo;"), 17},
+		{"U+0000", "a\x00b", []byte{'a', 0xc0, 0x80, 'b'}, 3},
+		{"two byte", "é", []byte{0xc3, 0xa9}, 1},
+		{"three byte", "中", []byte{0xe4, 0xb8, 0xad}, 1},
+		// U+1F600 is the surrogate pair D83D DE00.
+		{"supplementary", "x\U0001F600", []byte{'x', 0xed, 0xa0, 0xbd, 0xed, 0xb8, 0x80}, 3},
+		// Lone surrogates are kept as their three bytes.
+		{"lone high surrogate", "a\xed\xa0\xbdb", []byte{'a', 0xed, 0xa0, 0xbd, 'b'}, 3},
+		{"lone low surrogate", "\xed\xb8\x80", []byte{0xed, 0xb8, 0x80}, 1},
+		{"swapped pair", "\xed\xb8\x80\xed\xa0\xbd", []byte{0xed, 0xb8, 0x80, 0xed, 0xa0, 0xbd}, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Encode(tt.s); !bytes.Equal(got, tt.encoded) {
+				t.Errorf("Encode(%q) = % x, want % x", tt.s, got, tt.encoded)
+			}
+
+			got, err := Decode(tt.encoded)
+			if err != nil {
+				t.Fatalf("Decode(% x) returned %v", tt.encoded, err)
+			}
+			if got != tt.s {
+				t.Errorf("Decode(% x) = %q, want %q", tt.encoded, got, tt.s)
+			}
+
+			if got := UTF16Len(tt.s); got != tt.utf16Len {
+				t.Errorf("UTF16Len(%q) = %d, want %d", tt.s, got, tt.utf16Len)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded []byte
+		want    string
+		wantErr bool
+	}{
+		// Standard UTF-8 for a supplementary character isn't valid.
+		{name: "four byte sequence", encoded: []byte{0xf0, 0x9f, 0x98, 0x80}, wantErr: true},
+		{name: "NUL byte", encoded: []byte{'a', 0x00}, wantErr: true},
+		{name: "truncated two byte", encoded: []byte{0xc3}, wantErr: true},
+		{name: "truncated three byte", encoded: []byte{0xe4, 0xb8}, wantErr: true},
+		{name: "bad continuation", encoded: []byte{0xc3, 'a'}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Decode(tt.encoded)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Decode(% x) = %q, want an error", tt.encoded, got)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Decode(% x) returned %v", tt.encoded, err)
+			}
+			if got != tt.want {
+				t.Errorf("Decode(% x) = %q, want %q", tt.encoded, got, tt.want)
+			}
+		})
+	}
+}
+
+// Names which differ only in a lone surrogate, which can't be represented in
+// UTF-8, must still decode to different strings, or members named with them
+// would be counted as one.
+func TestDecodeLoneSurrogatesDistinct(t *testing.T) {
+	a, err := Decode([]byte{'f', 0xed, 0xa0, 0xbd})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Decode([]byte{'f', 0xed, 0xa0, 0xbe})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b {
+		t.Errorf("Decode() gives %q for both", a)
+	}
+}
+
+func TestEncodeInvalidUTF8(t *testing.T) {
+	if got, want := Encode("a\xffb"), []byte{'a', 0xef, 0xbf, 0xbd, 'b'}; !bytes.Equal(got, want) {
+		t.Errorf("Encode() = % x, want % x", got, want)
+	}
+}